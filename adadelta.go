@@ -0,0 +1,71 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+AdaDelta optimizer, Lr is 1 by default
+*/
+type AdaDelta struct {
+	Lr, Rho, Epsilon, Decay float64
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type stAdaDelta struct {
+	AccGrad, AccDelta *mx.NDArray
+}
+
+type implAdaDelta struct {
+	AdaDelta
+	scheduler
+	States map[*mx.NDArray]stAdaDelta
+}
+
+func (opt AdaDelta) Init(e int) Optimizer {
+	r := &implAdaDelta{AdaDelta: opt, States: make(map[*mx.NDArray]stAdaDelta)}
+	if r.Rho == 0 {
+		r.Rho = 0.9
+	}
+	if r.Epsilon == 0 {
+		r.Epsilon = 1e-5
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 1, opt.Schedule)
+	return r
+}
+
+func (opt *implAdaDelta) Release() {
+	for _, v := range opt.States {
+		v.AccGrad.Release()
+		v.AccDelta.Release()
+	}
+}
+
+func (opt *implAdaDelta) Update(params *mx.NDArray, grads *mx.NDArray) {
+	st, ok := opt.States[params]
+	if !ok {
+		st = stAdaDelta{AccGrad: params.NewLikeThis().Zeros(), AccDelta: params.NewLikeThis().Zeros()}
+		opt.States[params] = st
+	}
+	rho, eps := float32(opt.Rho), float32(opt.Epsilon)
+	g := grads.Clone()
+	defer g.Release()
+	if opt.Decay != 0 {
+		g.AddScaled(params, float32(opt.Decay))
+	}
+	t := g.Clone()
+	defer t.Release()
+	// AccGrad = rho*AccGrad + (1-rho)*g^2
+	st.AccGrad.Lerp(t.Square(), 1-rho)
+	// delta = sqrt(AccDelta+eps)/sqrt(AccGrad+eps) * g
+	t.CopyFrom(st.AccGrad).AddScalar(eps).Sqrt()
+	g.Div(t)
+	t.CopyFrom(st.AccDelta).AddScalar(eps).Sqrt()
+	g.Mul(t)
+	// AccDelta = rho*AccDelta + (1-rho)*delta^2
+	t.CopyFrom(g)
+	st.AccDelta.Lerp(t.Square(), 1-rho)
+	params.AddScaled(g, -float32(opt.lr))
+}
@@ -0,0 +1,55 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+AdaGrad optimizer, MXNet has fused kernel only for sparse gradients
+so update is calculated by elementwise operations
+*/
+type AdaGrad struct {
+	Lr, Epsilon, Decay float64
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type implAdaGrad struct {
+	AdaGrad
+	scheduler
+	States map[*mx.NDArray]*mx.NDArray
+}
+
+func (opt AdaGrad) Init(e int) Optimizer {
+	r := &implAdaGrad{AdaGrad: opt, States: make(map[*mx.NDArray]*mx.NDArray)}
+	if r.Epsilon == 0 {
+		r.Epsilon = 1e-7
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.01, opt.Schedule)
+	return r
+}
+
+func (opt *implAdaGrad) Release() {
+	for _, v := range opt.States {
+		v.Release()
+	}
+}
+
+func (opt *implAdaGrad) Update(params *mx.NDArray, grads *mx.NDArray) {
+	history, ok := opt.States[params]
+	if !ok {
+		history = params.NewLikeThis().Zeros()
+		opt.States[params] = history
+	}
+	g := grads.Clone()
+	defer g.Release()
+	if opt.Decay != 0 {
+		g.AddScaled(params, float32(opt.Decay))
+	}
+	d := g.Clone()
+	defer d.Release()
+	history.Add(d.Square())
+	d.CopyFrom(history).Sqrt().AddScalar(float32(opt.Epsilon))
+	params.AddScaled(g.Div(d), -float32(opt.lr))
+}
@@ -7,7 +7,8 @@ import (
 type Adam struct {
 	Lr, Beta1, Beta2, Epsilon, Decay float64
 
-	LrMap map[int]float64
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
 }
 
 type stAdam struct {
@@ -18,14 +19,12 @@ type stAdam struct {
 
 type implAdam struct {
 	Adam
+	scheduler
 	States map[*mx.NDArray]stAdam
 }
 
 func (opt Adam) Init(e int) Optimizer {
 	r := &implAdam{Adam: opt, States: make(map[*mx.NDArray]stAdam)}
-	if r.Lr == 0 {
-		r.Lr = locateLr(e, opt.LrMap, 0.001)
-	}
 	if r.Beta1 == 0 {
 		r.Beta1 = 0.9
 	}
@@ -35,6 +34,7 @@ func (opt Adam) Init(e int) Optimizer {
 	if r.Epsilon == 0 {
 		r.Epsilon = 1e-8
 	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.001, opt.Schedule)
 	return r
 }
 
@@ -53,5 +53,5 @@ func (opt *implAdam) Update(params *mx.NDArray, grads *mx.NDArray) {
 		st = stAdam{Var: v, Mean: m}
 		opt.States[params] = st
 	}
-	mx.AdamUpdate(params, grads, st.Mean, st.Var, opt.Lr, opt.Beta1, opt.Beta2, opt.Epsilon, opt.Decay)
+	mx.AdamUpdate(params, grads, st.Mean, st.Var, opt.lr, opt.Beta1, opt.Beta2, opt.Epsilon, opt.Decay)
 }
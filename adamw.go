@@ -0,0 +1,89 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"math"
+)
+
+// patterns of biases and BatchNorm params usually excluded from weight decay
+var DefaultNoDecay = []string{"*_bias", "*_gamma", "*_beta"}
+
+/*
+AdamW is Adam optimizer with decoupled weight decay which is 0.01 by default,
+params matched to NoDecay patterns are not decayed
+*/
+type AdamW struct {
+	Lr, Beta1, Beta2, Epsilon, Decay float64
+	NoDecay                          []string
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type implAdamW struct {
+	AdamW
+	scheduler
+	States  map[*mx.NDArray]*stAdam
+	noDecay func(string) bool
+}
+
+func (opt AdamW) Init(e int) Optimizer {
+	r := &implAdamW{AdamW: opt, States: make(map[*mx.NDArray]*stAdam), noDecay: noDecay(opt.NoDecay)}
+	if r.Beta1 == 0 {
+		r.Beta1 = 0.9
+	}
+	if r.Beta2 == 0 {
+		r.Beta2 = 0.999
+	}
+	if r.Epsilon == 0 {
+		r.Epsilon = 1e-8
+	}
+	if r.Decay == 0 {
+		r.Decay = 0.01
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.001, opt.Schedule)
+	return r
+}
+
+func (opt *implAdamW) Release() {
+	releaseAdamStates(opt.States)
+}
+
+func (opt *implAdamW) Update(params *mx.NDArray, grads *mx.NDArray) {
+	opt.UpdateNamed("", params, grads)
+}
+
+func (opt *implAdamW) UpdateNamed(name string, params *mx.NDArray, grads *mx.NDArray) {
+	d := adamDirection(opt.States, params, grads, opt.Beta1, opt.Beta2, opt.Epsilon)
+	defer d.Release()
+	if !opt.noDecay(name) {
+		d.AddScaled(params, float32(opt.Decay))
+	}
+	params.AddScaled(d, -float32(opt.lr))
+}
+
+func releaseAdamStates(states map[*mx.NDArray]*stAdam) {
+	for _, v := range states {
+		v.Var.Release()
+		v.Mean.Release()
+	}
+}
+
+/*
+adamDirection updates moments of param and returns new array with bias corrected Adam step direction
+*/
+func adamDirection(states map[*mx.NDArray]*stAdam, params, grads *mx.NDArray, beta1, beta2, epsilon float64) *mx.NDArray {
+	st, ok := states[params]
+	if !ok {
+		st = &stAdam{Var: params.NewLikeThis().Zeros(), Mean: params.NewLikeThis().Zeros()}
+		states[params] = st
+	}
+	st.Index++
+	t := float64(st.Index)
+	st.Mean.Lerp(grads, float32(1-beta1))
+	v := grads.Clone()
+	defer v.Release()
+	st.Var.Lerp(v.Square(), float32(1-beta2))
+	v.CopyFrom(st.Var).MulScalar(float32(1 / (1 - math.Pow(beta2, t)))).Sqrt().AddScalar(float32(epsilon))
+	return st.Mean.Clone().MulScalar(float32(1 / (1 - math.Pow(beta1, t)))).Div(v)
+}
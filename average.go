@@ -0,0 +1,148 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"strings"
+)
+
+/*
+Averaging is a way to average network params during training,
+averaged params are used to evaluate and to memorize the model
+*/
+type Averaging interface {
+	newAverager() *averager
+}
+
+/*
+EMA keeps exponential moving average of params updated after every optimizer step,
+Decay is 0.999 by default
+*/
+type EMA struct {
+	Decay float64
+}
+
+func (ema EMA) newAverager() *averager {
+	return &averager{decay: float32(fnzf(ema.Decay, 0.999))}
+}
+
+/*
+SWA keeps equal average of trainable params taken at the end of every epoch starting from the Start epoch.
+Running statistics of BatchNorm layers are recalibrated by one pass over training data with averaged params
+*/
+type SWA struct {
+	Start int
+}
+
+func (swa SWA) newAverager() *averager {
+	return &averager{swa: true, start: swa.Start}
+}
+
+type averager struct {
+	swa    bool
+	decay  float32
+	start  int
+	count  int
+	shadow map[string]*mx.NDArray
+}
+
+func (a *averager) Release() {
+	for _, s := range a.shadow {
+		s.Release()
+	}
+	a.shadow = nil
+}
+
+func (a *averager) update(network *Network, k float32) {
+	if a.shadow == nil {
+		a.shadow = map[string]*mx.NDArray{}
+		for n := range network.Params {
+			if n[0] != '_' && (!a.swa || network.Graph.Autograd[n]) {
+				a.shadow[n] = network.param(n).Clone()
+			}
+		}
+		return
+	}
+	for n, s := range a.shadow {
+		s.Lerp(network.param(n), k)
+	}
+}
+
+// step is called after every optimizer step
+func (a *averager) step(network *Network) {
+	if !a.swa {
+		a.update(network, 1-a.decay)
+	}
+}
+
+// epoch is called after training pass of epoch
+func (a *averager) epoch(network *Network, epoch int) {
+	if a.swa && epoch >= a.start {
+		a.count++
+		a.update(network, 1/float32(a.count))
+	}
+}
+
+/*
+use replaces network params by averaged ones while f is executed
+*/
+func (a *averager) use(network *Network, fd feed, f func() error) (err error) {
+	if a == nil || a.shadow == nil {
+		return f()
+	}
+	backup := map[string]*mx.NDArray{}
+	for n := range network.Params {
+		if n[0] != '_' {
+			backup[n] = network.param(n).Clone()
+		}
+	}
+	defer func() {
+		for n, b := range backup {
+			network.copyParam(n, b)
+			b.Release()
+		}
+	}()
+	for n, s := range a.shadow {
+		network.copyParam(n, s)
+	}
+	if a.swa {
+		if err = network.recalibrate(fd); err != nil {
+			return
+		}
+	}
+	return f()
+}
+
+/*
+hasBatchNorm returns true if network has BatchNorm layers
+*/
+func (network *Network) hasBatchNorm() bool {
+	for n := range network.Params {
+		if strings.HasSuffix(n, "_rmean") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+recalibrate resets running statistics of BatchNorm layers
+and calculates them again by forward pass over training data,
+non-gradient variables assigned on training forward (like SpectralNorm vectors) are kept as is
+*/
+func (network *Network) recalibrate(fd feed) error {
+	assigns := network.Graph.Assigns
+	network.Graph.Assigns = nil
+	defer func() { network.Graph.Assigns = assigns }()
+	for n, p := range network.Params {
+		if strings.HasSuffix(n, "_rmean") {
+			p.Zeros()
+		} else if strings.HasSuffix(n, "_rvar") {
+			p.Ones()
+		}
+	}
+	return fd.train(func(b *batch) error {
+		network.feedBatch(b, false)
+		network.Graph.Forward(true)
+		return nil
+	})
+}
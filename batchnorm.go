@@ -9,6 +9,7 @@ type BatchNorm struct {
 	Name           string
 	Mom, Epsilon   float32
 	UseGlobalStats bool
+	Freeze         bool // gamma and beta are frozen, see Model.Unfreeze
 }
 
 func (ly BatchNorm) Combine(in *mx.Symbol) *mx.Symbol {
@@ -19,8 +20,8 @@ func (ly BatchNorm) Combine(in *mx.Symbol) *mx.Symbol {
 		ns += "$BN"
 	}
 
-	gamma := mx.Var(ns+"_gamma", Const{1})
-	beta := mx.Var(ns+"_beta", Const{0})
+	gamma := mx.Var(ns+"_gamma", Const{1}, frozen(ly.Freeze))
+	beta := mx.Var(ns+"_beta", Const{0}, frozen(ly.Freeze))
 	running_mean := mx.Var(ns+"_rmean", mx.Nograd, Const{0})
 	running_var := mx.Var(ns+"_rvar", mx.Nograd, Const{1})
 	out := mx.BatchNorm(in, gamma, beta, running_mean, running_var, ly.Mom, ly.Epsilon, ly.UseGlobalStats)
@@ -0,0 +1,141 @@
+package nn
+
+import (
+	"go4ml.xyz/base/fu"
+	"golang.org/x/xerrors"
+)
+
+/*
+Callback is notified by Train about training progress,
+it can stop training or change learning rate through TrainContext
+*/
+type Callback interface {
+	OnTrainBegin(tc *TrainContext)
+	OnEpochBegin(tc *TrainContext, epoch int)
+	// OnBatchEnd is called after every trained batch with mean loss of batch rows
+	// and count of optimizer steps done from the training start
+	OnBatchEnd(tc *TrainContext, step int, loss float32)
+	// OnEpochEnd is called with metrics of the evaluated epoch before the model is memorized
+	OnEpochEnd(tc *TrainContext, epoch int, train, test fu.Struct)
+	OnTrainEnd(tc *TrainContext)
+}
+
+/*
+NopCallback implements Callback doing nothing, it's embedded to implement only required methods
+*/
+type NopCallback struct{}
+
+func (NopCallback) OnTrainBegin(*TrainContext)                          {}
+func (NopCallback) OnEpochBegin(*TrainContext, int)                     {}
+func (NopCallback) OnBatchEnd(*TrainContext, int, float32)              {}
+func (NopCallback) OnEpochEnd(*TrainContext, int, fu.Struct, fu.Struct) {}
+func (NopCallback) OnTrainEnd(*TrainContext)                            {}
+
+/*
+TrainContext is the state of training passed to callbacks
+*/
+type TrainContext struct {
+	Network   *Network
+	Optimizer Optimizer
+	stopped   bool
+	lr        float64 // learning rate set by SetLr, it's kept in checkpoint
+}
+
+/*
+Stop stops training after the current batch, the epoch is evaluated and memorized as the last one
+*/
+func (tc *TrainContext) Stop() {
+	tc.stopped = true
+}
+
+/*
+Stopped returns true if training is stopped
+*/
+func (tc *TrainContext) Stopped() bool {
+	return tc.stopped
+}
+
+/*
+Lr returns the current learning rate of optimizer or 0 if optimizer does not have it
+*/
+func (tc *TrainContext) Lr() float64 {
+	if so, ok := tc.Optimizer.(ScheduledOptimizer); ok {
+		return so.CurrentLr()
+	}
+	return 0
+}
+
+/*
+SetLr replaces scheduled learning rate of optimizer till the end of training,
+zero lr restores the scheduled one. Learning rate can be changed for SGD, Adam, AdamW, Nadam, RMSProp,
+AdaGrad, AdaDelta, FTRL, LAMB and LARS optimizers and for Lookahead, SAM and ParamGroups wrapping them.
+SetLr does nothing and returns false for other optimizers like LBFGS
+*/
+func (tc *TrainContext) SetLr(lr float64) bool {
+	if ls, ok := tc.Optimizer.(lrSetter); ok {
+		tc.lr = lr
+		return ls.setLr(lr)
+	}
+	return false
+}
+
+// errStopped interrupts training pass when training is stopped by callback
+var errStopped = xerrors.New("training is stopped")
+
+/*
+callbacks notifies all callbacks of model
+*/
+type callbacks struct {
+	TrainContext
+	list []Callback
+}
+
+func (cb *callbacks) trainBegin() {
+	for _, c := range cb.list {
+		c.OnTrainBegin(&cb.TrainContext)
+	}
+}
+
+func (cb *callbacks) epochBegin(epoch int) {
+	for _, c := range cb.list {
+		c.OnEpochBegin(&cb.TrainContext, epoch)
+	}
+}
+
+/*
+batchEnd notifies callbacks about trained batch of length rows
+*/
+func (cb *callbacks) batchEnd(length int) {
+	if len(cb.list) == 0 {
+		return
+	}
+	loss := cb.Network.Graph.Loss.ValuesF32()
+	var l float32
+	if len(loss) > 1 {
+		for _, v := range loss[:length] {
+			l += v
+		}
+		l /= float32(length)
+	} else {
+		l = loss[0]
+	}
+	cb.lossEnd(l)
+}
+
+func (cb *callbacks) lossEnd(loss float32) {
+	for _, c := range cb.list {
+		c.OnBatchEnd(&cb.TrainContext, cb.Network.Steps, loss)
+	}
+}
+
+func (cb *callbacks) epochEnd(epoch int, train, test fu.Struct) {
+	for _, c := range cb.list {
+		c.OnEpochEnd(&cb.TrainContext, epoch, train, test)
+	}
+}
+
+func (cb *callbacks) trainEnd() {
+	for _, c := range cb.list {
+		c.OnTrainEnd(&cb.TrainContext)
+	}
+}
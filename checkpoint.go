@@ -0,0 +1,407 @@
+package nn
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/zorros"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const checkpointPartState = "state.yaml"
+const checkpointPartParams = "params.bin"
+const checkpointPartOptimizer = "optimizer.bin"
+const checkpointPartAverage = "average.bin"
+const checkpointPartBest = "best.bin"
+const checkpointPartValidated = "validated.bin"
+
+/*
+Checkpoint periodically writes state of training which is resumed by Model.Resume.
+State contains params, optimizer state, count of trained epochs, seeds and history of metrics
+*/
+type Checkpoint struct {
+	// File is a checkpoint file, if it has %v the last checkpoint is written to file with %v replaced by "last"
+	// and the best checkpoints are kept in files with %v replaced by "best1", "best2" and so on from the best one
+	File  string
+	Every int // count of epochs between checkpoints, 1 by default
+	Best  int // count of the best checkpoints to keep if File has %v
+
+	Metric   string // test metric choosing the best checkpoints, DefaultEarlyStopMetric by default
+	Maximize bool   // metric is better when it's greater
+}
+
+/*
+metricsRecord is the serializable form of metrics
+*/
+type metricsRecord struct {
+	Names  []string      `yaml:"names"`
+	Values []interface{} `yaml:"values"`
+}
+
+func recordOf(s fu.Struct) metricsRecord {
+	r := metricsRecord{Names: s.Names, Values: make([]interface{}, len(s.Columns))}
+	for i, c := range s.Columns {
+		r.Values[i] = c.Interface()
+	}
+	return r
+}
+
+func (r metricsRecord) metrics() fu.Struct {
+	s := fu.Struct{Names: r.Names, Columns: make([]reflect.Value, len(r.Values))}
+	for i, v := range r.Values {
+		s.Columns[i] = reflect.ValueOf(v)
+	}
+	return s
+}
+
+type epochRecord struct {
+	Epoch int           `yaml:"epoch"`
+	Train metricsRecord `yaml:"train"`
+	Test  metricsRecord `yaml:"test"`
+}
+
+type bestRecord struct {
+	Epoch int     `yaml:"epoch"`
+	Value float64 `yaml:"value"`
+}
+
+/*
+checkpointState is the training state written to checkpoint with arrays of network and optimizer,
+gradients accumulated by AccumulateSteps are applied at the end of every epoch so they are not kept
+*/
+type checkpointState struct {
+	Epoch     int           `yaml:"epoch"` // the last trained epoch
+	Seed      int           `yaml:"seed"`
+	Lr        float64       `yaml:"lr,omitempty"` // learning rate set by callback
+	LossScale float32       `yaml:"loss_scale"`
+	ScaleGood int           `yaml:"scale_good"`
+	Private   int           `yaml:"private_steps"`
+	Average   int           `yaml:"average_count"`
+	History   []epochRecord `yaml:"history"`
+	Best      []bestRecord  `yaml:"best"` // the best checkpoints ordered from the best one
+
+	Stopper *struct {
+		Best float64     `yaml:"best"`
+		Bad  int         `yaml:"bad"`
+		Last epochRecord `yaml:"metrics"`
+	} `yaml:"stopper"`
+}
+
+/*
+checkpointer writes checkpoints during training
+*/
+type checkpointer struct {
+	Checkpoint
+	state checkpointState
+}
+
+func (ck Checkpoint) newCheckpointer(seed int) *checkpointer {
+	ck.Every = fu.Ifei(ck.Every > 0, ck.Every, 1)
+	ck.Metric = fu.Fnzs(ck.Metric, DefaultEarlyStopMetric)
+	return &checkpointer{Checkpoint: ck, state: checkpointState{Seed: seed}}
+}
+
+/*
+trainingState is the state of training components kept in checkpoint
+*/
+type trainingState struct {
+	network *Network
+	avg     *averager
+	stopper *earlyStopper
+	private *privateTrainer
+	best    *paramsCopy // params of the best completed epoch evaluating test rows
+	tc      *TrainContext
+}
+
+// arrayDtype returns dtype of array values written in the params file format
+func arrayDtype(a *mx.NDArray) mx.Dtype {
+	if a.Dtype() == mx.Float64 {
+		return mx.Float64
+	}
+	return mx.Float32
+}
+
+// arrayValue returns dimension and values of array to write them in the params file format
+func arrayValue(a *mx.NDArray) (mx.Dimension, interface{}) {
+	if a.Dtype() == mx.Float64 {
+		return a.Dim(), a.Values(mx.Float64)
+	}
+	return a.Dim(), a.ValuesF32()
+}
+
+func writeArrays(output iokit.Output, m map[string]*mx.NDArray) error {
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return writeParams(output, names,
+		func(n string) mx.Dtype { return arrayDtype(m[n]) },
+		func(n string) (mx.Dimension, interface{}) { return arrayValue(m[n]) })
+}
+
+/*
+readArrays reads arrays of params written by writeArrays, arrays are created like network params if they are absent
+*/
+func (network *Network) readArrays(input iokit.Input, m map[string]*mx.NDArray) (err error) {
+	var r *ParamsReader
+	if r, err = NewParamsReader(input); err != nil {
+		return
+	}
+	defer r.Close()
+	for r.HasMore() {
+		n, dim, _, v, err := r.NextValues()
+		if err != nil {
+			return err
+		}
+		a, ok := m[n]
+		if !ok {
+			p, ok := network.Params[n]
+			if !ok || p.Dim() != dim {
+				continue
+			}
+			a = network.param(n).Clone()
+			m[n] = a
+		}
+		a.SetValues(v)
+	}
+	return
+}
+
+/*
+update records metrics of the completed epoch and writes checkpoint if it's required
+*/
+func (ck *checkpointer) update(epoch int, train, test fu.Struct, ts trainingState) error {
+	ck.state.Epoch = epoch
+	ck.state.History = append(ck.state.History, epochRecord{epoch, recordOf(train), recordOf(test)})
+	if (epoch+1)%ck.Every != 0 {
+		return nil
+	}
+	if !strings.Contains(ck.File, "%v") {
+		return ck.write(iokit.File(ck.File), ts)
+	}
+	rank := -1
+	if ck.Best > 0 {
+		v, ok := metricValue(test, ck.Metric)
+		if !ok {
+			return zorros.Errorf("there is no numeric metric `%v` to choose the best checkpoint", ck.Metric)
+		}
+		if ck.Maximize {
+			v = -v
+		}
+		best := append(ck.state.Best, bestRecord{epoch, v})
+		sort.SliceStable(best, func(i, j int) bool { return best[i].Value < best[j].Value })
+		ck.state.Best = best[:fu.Ifei(len(best) < ck.Best, len(best), ck.Best)]
+		for i, b := range ck.state.Best {
+			if b.Epoch == epoch {
+				rank = i
+			}
+		}
+	}
+	if err := ck.write(iokit.File(fmt.Sprintf(ck.File, "last")), ts); err != nil {
+		return err
+	}
+	if rank < 0 {
+		return nil
+	}
+	// worse checkpoints are moved by one file and the worst one is overwritten if there are enough of them
+	for i := len(ck.state.Best) - 1; i > rank; i-- {
+		if err := copyFile(iokit.File(ck.bestFile(i-1)), iokit.File(ck.bestFile(i))); err != nil {
+			return err
+		}
+	}
+	return ck.write(iokit.File(ck.bestFile(rank)), ts)
+}
+
+// bestFile returns the file of the best checkpoint having rank i counting from zero
+func (ck *checkpointer) bestFile(i int) string {
+	return fmt.Sprintf(ck.File, fmt.Sprintf("best%d", i+1))
+}
+
+func copyFile(input iokit.Input, output iokit.Output) (err error) {
+	var rd io.ReadCloser
+	if rd, err = input.Open(); err != nil {
+		return zorros.Trace(err)
+	}
+	defer rd.Close()
+	var wh iokit.Whole
+	if wh, err = output.Create(); err != nil {
+		return zorros.Trace(err)
+	}
+	defer wh.End()
+	if _, err = io.Copy(wh, rd); err != nil {
+		return zorros.Trace(err)
+	}
+	return wh.Commit()
+}
+
+func (ck *checkpointer) write(output iokit.Output, ts trainingState) (err error) {
+	st := ck.state
+	if m := ts.network.mixed; m != nil {
+		st.LossScale, st.ScaleGood = m.scale, m.good
+	}
+	if ts.private != nil {
+		st.Private = ts.private.steps
+	}
+	if ts.avg != nil {
+		st.Average = ts.avg.count
+	}
+	if ts.tc != nil {
+		st.Lr = ts.tc.lr
+	}
+	if s := ts.stopper; s != nil && s.found {
+		st.Stopper = &struct {
+			Best float64     `yaml:"best"`
+			Bad  int         `yaml:"bad"`
+			Last epochRecord `yaml:"metrics"`
+		}{s.best, s.bad, epochRecord{Train: recordOf(s.train), Test: recordOf(s.test)}}
+	}
+	var wh iokit.Whole
+	if wh, err = output.Create(); err != nil {
+		return zorros.Trace(err)
+	}
+	defer wh.End()
+	zw := zip.NewWriter(wh)
+	add := func(name string, f func(iokit.Output) error) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return zorros.Trace(err)
+		}
+		return f(iokit.Writer(w))
+	}
+	if err = add(checkpointPartParams, func(o iokit.Output) error { return ts.network.SaveParams(o) }); err != nil {
+		return
+	}
+	if ts.network.opt != nil {
+		if err = add(checkpointPartOptimizer, func(o iokit.Output) error {
+			return ts.network.SaveOptimizerState(ts.network.opt, o)
+		}); err != nil {
+			return
+		}
+	}
+	if ts.avg != nil && ts.avg.shadow != nil {
+		if err = add(checkpointPartAverage, func(o iokit.Output) error { return writeArrays(o, ts.avg.shadow) }); err != nil {
+			return
+		}
+	}
+	if ts.best != nil && *ts.best != nil {
+		if err = add(checkpointPartValidated, func(o iokit.Output) error { return writeArrays(o, *ts.best) }); err != nil {
+			return
+		}
+	}
+	if st.Stopper != nil {
+		if err = add(checkpointPartBest, func(o iokit.Output) error { return writeArrays(o, ts.stopper.params) }); err != nil {
+			return
+		}
+	}
+	if err = add(checkpointPartState, func(o iokit.Output) error {
+		w, err := o.Create()
+		if err != nil {
+			return err
+		}
+		defer w.End()
+		if err = yaml.NewEncoder(w).Encode(st); err != nil {
+			return err
+		}
+		return w.Commit()
+	}); err != nil {
+		return
+	}
+	if err = zw.Close(); err != nil {
+		return zorros.Trace(err)
+	}
+	return wh.Commit()
+}
+
+type zipInput struct{ f *zip.File }
+
+func (z zipInput) Open() (io.ReadCloser, error) { return z.f.Open() }
+
+/*
+resume restores training state from checkpoint and returns the checkpointed state
+*/
+func resume(input iokit.Input, ts trainingState) (st checkpointState, err error) {
+	var rd io.ReadCloser
+	if rd, err = input.Open(); err != nil {
+		return st, zorros.Trace(err)
+	}
+	bs, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		return st, zorros.Trace(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		return st, zorros.Trace(err)
+	}
+	parts := map[string]iokit.Input{}
+	for _, f := range zr.File {
+		parts[f.Name] = zipInput{f}
+	}
+	if _, ok := parts[checkpointPartState]; !ok {
+		return st, zorros.Errorf("it's not training checkpoint")
+	}
+	if rd, err = parts[checkpointPartState].Open(); err != nil {
+		return st, zorros.Trace(err)
+	}
+	err = yaml.NewDecoder(rd).Decode(&st)
+	rd.Close()
+	if err != nil {
+		return st, zorros.Trace(err)
+	}
+	if err = ts.network.LoadParams(parts[checkpointPartParams], true); err != nil {
+		return
+	}
+	if p, ok := parts[checkpointPartOptimizer]; ok && ts.network.opt != nil {
+		if err = ts.network.LoadOptimizerState(ts.network.opt, p); err != nil {
+			return
+		}
+	}
+	if m := ts.network.mixed; m != nil && st.LossScale > 0 {
+		m.setScale(ts.network, st.LossScale)
+		m.good = st.ScaleGood
+	}
+	if ts.private != nil {
+		ts.private.steps = st.Private
+	}
+	if ts.tc != nil && st.Lr != 0 {
+		ts.tc.SetLr(st.Lr)
+	}
+	if p, ok := parts[checkpointPartAverage]; ok && ts.avg != nil {
+		ts.avg.count = st.Average
+		if ts.avg.shadow == nil {
+			ts.avg.shadow = map[string]*mx.NDArray{}
+		}
+		if err = ts.network.readArrays(p, ts.avg.shadow); err != nil {
+			return
+		}
+	}
+	if p, ok := parts[checkpointPartValidated]; ok && ts.best != nil {
+		if *ts.best == nil {
+			*ts.best = paramsCopy{}
+		}
+		if err = ts.network.readArrays(p, *ts.best); err != nil {
+			return
+		}
+	}
+	if p, ok := parts[checkpointPartBest]; ok && ts.stopper != nil && st.Stopper != nil {
+		s := ts.stopper
+		s.best, s.bad, s.found = st.Stopper.Best, st.Stopper.Bad, true
+		s.train, s.test = st.Stopper.Last.Train.metrics(), st.Stopper.Last.Test.metrics()
+		if s.params == nil {
+			s.params = paramsCopy{}
+		}
+		if err = ts.network.readArrays(p, s.params); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package nn
+
+import (
+	"go4ml.xyz/base/fu"
+	"math"
+)
+
+/*
+clipGrads clips gradients by value and then by global norm over all gradients,
+the global norm before clipping is kept in GradNorm
+*/
+func (network *Network) clipGrads() {
+	if network.ClipValue > 0 {
+		for _, g := range network.Graph.Grads {
+			g.Clip(-network.ClipValue, network.ClipValue)
+		}
+	}
+	network.GradNorm = network.gradNorm()
+	if network.ClipGlobalNorm > 0 && network.GradNorm > network.ClipGlobalNorm {
+		k := network.ClipGlobalNorm / network.GradNorm
+		for _, g := range network.Graph.Grads {
+			g.MulScalar(k)
+		}
+	}
+}
+
+/*
+gradNorm returns global norm over all gradients
+*/
+func (network *Network) gradNorm() float32 {
+	sq := 0.
+	for _, g := range network.Graph.Grads {
+		n := float64(g.Norm())
+		sq += n * n
+	}
+	return float32(math.Sqrt(sq))
+}
+
+/*
+gradNormMetric accumulates global gradient norms of training steps
+*/
+type gradNormMetric struct {
+	sum, max float64
+	count    int
+}
+
+func (gm *gradNormMetric) update(norm float32) {
+	gm.sum += float64(norm)
+	gm.max = math.Max(gm.max, float64(norm))
+	gm.count++
+}
+
+func (gm *gradNormMetric) complete(train, test fu.Struct) (fu.Struct, fu.Struct) {
+	mean := 0.
+	if gm.count > 0 {
+		mean = gm.sum / float64(gm.count)
+	}
+	for _, s := range []*fu.Struct{&train, &test} {
+		*s = withMetric(withMetric(*s, "GradNorm", mean), "MaxGradNorm", gm.max)
+	}
+	return train, test
+}
@@ -0,0 +1,167 @@
+package nn
+
+import (
+	"context"
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/base/model"
+	"go4ml.xyz/base/tables"
+	"go4ml.xyz/zorros"
+	"math"
+	"math/rand"
+	"reflect"
+)
+
+// flag column of validation rows CrossValidate adds to dataset
+const ValidationCol = "Validation"
+
+/*
+CrossValidation is the result of k-fold cross-validation
+*/
+type CrossValidation struct {
+	Folds []*model.Report
+	// Validation are metrics of validation rows reported by the best epoch of every fold
+	Validation []fu.Struct
+	// Mean and Std are mean and standard deviation of numeric validation metrics of folds
+	Mean, Std fu.Struct
+	// OutOfFold is the dataset with predictions of networks trained without predicted rows,
+	// test rows are not predicted
+	OutOfFold *tables.Table
+}
+
+/*
+CrossValidate trains k networks, every network is validated on one of k folds of non-test rows
+and trained on other folds. Folds are chosen randomly using model Seed.
+Test rows are not trained or validated and they are evaluated by every fold network with params of the best epoch,
+so folds report validation metrics in Report.Test only if dataset does not have test rows.
+Out-of-fold predictions are made with params of the best epoch too.
+Models of folds are memorized to training ModelFile one after another
+*/
+func (e Model) CrossValidate(ds model.Dataset, k int, training model.Training) (cv *CrossValidation, err error) {
+	if k < 2 {
+		return nil, zorros.Errorf("cross-validation needs at least 2 folds")
+	}
+	t, err := ds.Source.Lazy().Collect()
+	if err != nil {
+		return
+	}
+	Test := fu.Fnzs(ds.Test, model.TestCol)
+	if fu.IndexOf(Test, t.Names()) < 0 {
+		return nil, zorros.Errorf("dataset does not have column `%v`", Test)
+	}
+	testCol := t.Col(Test).ExtractAs(fu.Bool, true).([]bool)
+	var rows []int
+	for i, test := range testCol {
+		if !test {
+			rows = append(rows, i)
+		}
+	}
+	if len(rows) < k {
+		return nil, zorros.Errorf("dataset does not have enough rows for %d folds", k)
+	}
+	fold := make([]int, t.Len())
+	for j, i := range rand.New(rand.NewSource(int64(e.Seed))).Perm(len(rows)) {
+		fold[rows[i]] = j % k
+	}
+
+	features := t.OnlyNames(ds.Features...)
+	predicts := fu.Fnzs(e.Predicted, model.PredictedCol)
+	e.Validation = ValidationCol
+	oof := make([]reflect.Value, t.Len())
+	cv = &CrossValidation{}
+	for f := 0; f < k; f++ {
+		valid := make([]bool, t.Len())
+		var index []int
+		for _, i := range rows {
+			if valid[i] = fold[i] == f; valid[i] {
+				index = append(index, i)
+			}
+		}
+		ft := t.With(tables.Col(valid), ValidationCol)
+		fds := ds
+		fds.Source = ft
+		var network *Network
+		var validation fu.Struct
+		report, err := model.FatModel(func(w model.Workout) (r *model.Report, err error) {
+			r, network, validation, err = train(context.Background(), e, fds, w, DefaultModelMap)
+			return
+		}).Train(training)
+		if err != nil {
+			return nil, zorros.Wrapf(err, "failed to train fold %d: %s", f, err.Error())
+		}
+		cv.Folds = append(cv.Folds, report)
+		cv.Validation = append(cv.Validation, validation)
+		err = network.predictRows(ft, features, predicts, func(n int, v reflect.Value) { oof[index[n]] = v })
+		network.Release()
+		if err != nil {
+			return nil, zorros.Wrapf(err, "failed to predict fold %d: %s", f, err.Error())
+		}
+	}
+	cv.Mean, cv.Std = meanStd(cv.Validation)
+
+	var tp reflect.Type
+	for _, v := range oof {
+		if v.IsValid() {
+			tp = v.Type()
+			break
+		}
+	}
+	col := reflect.MakeSlice(reflect.SliceOf(tp), t.Len(), t.Len())
+	for i, v := range oof {
+		if v.IsValid() {
+			col.Index(i).Set(v)
+		}
+	}
+	cv.OutOfFold = t.With(tables.Col(col.Interface()), predicts)
+	return
+}
+
+/*
+predictRows calls f with predicted value of every validation row of table
+*/
+func (network *Network) predictRows(t *tables.Table, features []string, predicts string, f func(int, reflect.Value)) error {
+	fm := &FeaturesMapper{model: PredictionModel{features: features, predicts: predicts}, network: network}
+	n := 0
+	return t.Lazy().IfFlag(ValidationCol).Batch(network.BatchSize).Drain(func(value reflect.Value) error {
+		if value.Kind() == reflect.Bool {
+			return nil
+		}
+		r, err := fm.MapFeatures(value.Interface().(*tables.Table))
+		if err != nil {
+			return err
+		}
+		c := r.Col(predicts)
+		for i := 0; i < c.Len(); i++ {
+			f(n, c.Value(i))
+			n++
+		}
+		return nil
+	})
+}
+
+/*
+meanStd returns mean and standard deviation of numeric metrics
+*/
+func meanStd(metrics []fu.Struct) (mean, std fu.Struct) {
+	for _, name := range metrics[0].Names {
+		var vals []float64
+		for _, m := range metrics {
+			if v, ok := metricValue(m, name); ok {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) != len(metrics) {
+			continue
+		}
+		m, d := 0., 0.
+		for _, v := range vals {
+			m += v
+		}
+		m /= float64(len(vals))
+		for _, v := range vals {
+			d += (v - m) * (v - m)
+		}
+		mean = withMetric(mean, name, m)
+		std = withMetric(std, name, math.Sqrt(d/float64(len(vals))))
+	}
+	return
+}
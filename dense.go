@@ -22,6 +22,12 @@ type FullyConnected struct {
 	Name       string
 	Output     bool
 	Dropout    float32
+	Freeze     bool // weight and bias are frozen, see Model.Unfreeze
+
+	WeightPenalty    Penalty       // L1/L2 penalty of weights added to the loss
+	ActivityPenalty  Penalty       // L1/L2 penalty of layer output added to the loss
+	WeightConstraint mx.Constraint // applied to weights after every optimizer update
+	BiasConstraint   mx.Constraint // applied to bias after every optimizer update
 }
 
 func (ly FullyConnected) Combine(in *mx.Symbol) *mx.Symbol {
@@ -30,27 +36,28 @@ func (ly FullyConnected) Combine(in *mx.Symbol) *mx.Symbol {
 	if ns == "" {
 		ns = fmt.Sprintf("FullyConnected%02d", NextSymbolId())
 	}
-	weight := mx.Var(ns+"_weight", ly.WeightInit)
+	weight := mx.Var(ns+"_weight", ly.WeightInit, ly.WeightConstraint, frozen(ly.Freeze))
 	if !ly.NoBias {
 		init := ly.BiasInit
 		if init == nil {
 			init = &Const{0}
 		}
-		bias = mx.Var(ns+"_bias", init)
+		bias = mx.Var(ns+"_bias", init, ly.BiasConstraint, frozen(ly.Freeze))
 	}
 	out := mx.FullyConnected(in, weight, bias, ly.Size, !ly.NoFlatten)
 	out.SetName(ns)
 	if ly.BatchNorm {
-		out = BatchNorm{Name: ns}.Combine(out)
+		out = BatchNorm{Name: ns, Freeze: ly.Freeze}.Combine(out)
 	}
 	if ly.Activation != nil {
 		out = ly.Activation(out)
 		out.SetName(ns + "$A")
 	}
+	activity := ly.ActivityPenalty.Activity(out)
 	if ly.Dropout > 0.01 {
 		out = mx.Dropout(out, ly.Dropout)
 		out.SetName(ns + "$D")
 	}
 	out.SetOutput(ly.Output)
-	return out
+	return penalize(out, ly.WeightPenalty.Weight(weight), activity)
 }
@@ -0,0 +1,130 @@
+package nn
+
+import (
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/zorros"
+	"reflect"
+)
+
+// metric early stopping watches by default
+const DefaultEarlyStopMetric = "Loss"
+
+/*
+EarlyStopping stops training when the test metric is not improved for Patience epochs,
+the network is restored to params of the best epoch and the best epoch metrics are reported.
+It's done also when training is finished by other reason like the last iteration of workout
+*/
+type EarlyStopping struct {
+	Metric   string  // test metric to watch, DefaultEarlyStopMetric by default
+	Patience int     // count of epochs without improvement before stop, 1 by default
+	MinDelta float64 // minimal change of metric counted as improvement
+	Maximize bool    // metric is improved when it increases, it should decrease by default
+}
+
+/*
+paramsCopy keeps copies of network params except internal ones
+*/
+type paramsCopy map[string]*mx.NDArray
+
+func (pc *paramsCopy) save(network *Network) {
+	if *pc == nil {
+		*pc = paramsCopy{}
+	}
+	for n := range network.Params {
+		if n[0] == '_' {
+			continue
+		}
+		if p, ok := (*pc)[n]; ok {
+			p.CopyFrom(network.param(n))
+		} else {
+			(*pc)[n] = network.param(n).Clone()
+		}
+	}
+}
+
+func (pc paramsCopy) restore(network *Network) {
+	for n, p := range pc {
+		network.copyParam(n, p)
+	}
+}
+
+func (pc *paramsCopy) Release() {
+	for _, p := range *pc {
+		p.Release()
+	}
+	*pc = nil
+}
+
+/*
+earlyStopper keeps the best metric value with params and metrics of the best epoch
+*/
+type earlyStopper struct {
+	EarlyStopping
+	best        float64
+	bad         int
+	params      paramsCopy
+	train, test fu.Struct
+	found       bool
+}
+
+func (es EarlyStopping) newStopper() *earlyStopper {
+	es.Metric = fu.Fnzs(es.Metric, DefaultEarlyStopMetric)
+	es.Patience = fu.Ifei(es.Patience > 0, es.Patience, 1)
+	return &earlyStopper{EarlyStopping: es}
+}
+
+func (s *earlyStopper) Release() {
+	s.params.Release()
+}
+
+func metricValue(m fu.Struct, name string) (float64, bool) {
+	i := fu.IndexOf(name, m.Names)
+	if i < 0 {
+		return 0, false
+	}
+	v := m.Columns[i]
+	switch {
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float(), true
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return float64(v.Int()), true
+	}
+	return 0, false
+}
+
+/*
+update remembers evaluated params and metrics of the improved epoch,
+it returns true with the best epoch metrics when training should be stopped or the epoch is the last one.
+Then params of the best epoch are set to network to be memorized, they have to be set again after evaluation
+because evaluation of averaged params restores trained ones
+*/
+func (s *earlyStopper) update(network *Network, train, test fu.Struct, last bool) (fu.Struct, fu.Struct, bool, error) {
+	v, ok := metricValue(test, s.Metric)
+	if !ok {
+		return train, test, false, zorros.Errorf("there is no numeric metric `%v` to stop early", s.Metric)
+	}
+	if s.Maximize {
+		v = -v
+	}
+	if !s.found || v < s.best-s.MinDelta {
+		s.best, s.bad, s.found = v, 0, true
+		s.train, s.test = train, test
+		s.params.save(network)
+		return train, test, false, nil
+	}
+	if s.bad++; s.bad < s.Patience && !last {
+		return train, test, false, nil
+	}
+	s.params.restore(network)
+	return s.train, s.test, true, nil
+}
+
+/*
+restore sets params of the best epoch to network
+*/
+func (s *earlyStopper) restore(network *Network) {
+	if s != nil && s.found {
+		s.params.restore(network)
+	}
+}
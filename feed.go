@@ -0,0 +1,152 @@
+package nn
+
+import (
+	"context"
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/base/model"
+	"go4ml.xyz/base/tables"
+	"math/rand"
+	"reflect"
+)
+
+/*
+batch is a network input prepared for one training or evaluation step
+*/
+type batch struct {
+	features []float32
+	labels   []float32
+	length   int // count of real rows, the rest of batch is padding
+	label    func(int) reflect.Value
+	test     func(int) bool
+	valid    func(int) bool // nil if dataset does not have validation rows
+	grouped  bool           // batch is aligned to groups and padded rows are excluded by loss
+}
+
+/*
+validation returns true if row is a validation row
+*/
+func (b *batch) validation(i int) bool {
+	return b.valid != nil && b.valid(i)
+}
+
+/*
+feed is a source of batches, train iterates over training rows only,
+eval iterates over the whole dataset and test iterates over rows reported as test ones
+*/
+type feed struct {
+	train func(func(*batch) error) error
+	eval  func(func(*batch) error) error
+	test  func(func(*batch) error) error
+}
+
+func tableBatch(t *tables.Table, features []string, label, test, valid string, batchSize int) (*batch, error) {
+	m, err := t.MatrixWithLabel(features, label, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	testCol := t.Col(test).ExtractAs(fu.Bool, true).([]bool)
+	b := &batch{
+		features: m.Features,
+		labels:   m.Labels,
+		length:   t.Len(),
+		label:    t.Col(label).Value,
+		test:     func(i int) bool { return testCol[i] },
+	}
+	if valid != "" {
+		validCol := t.Col(valid).ExtractAs(fu.Bool, true).([]bool)
+		b.valid = func(i int) bool { return validCol[i] }
+	}
+	return b, nil
+}
+
+/*
+streamFeed iterates over dataset by batches, validation rows are excluded from training if valid column is specified
+*/
+func streamFeed(dataset model.Dataset, features []string, label, test, valid string, batchSize int) feed {
+	lazy := dataset.Source.Lazy().IfNotFlag(test)
+	if valid != "" {
+		lazy = lazy.IfNotFlag(valid)
+	}
+	train := lazy.Batch(batchSize).Parallel()
+	full := dataset.Source.Lazy().Batch(batchSize).Parallel()
+	tested := dataset.Source.Lazy().IfFlag(fu.Fnzs(valid, test)).Batch(batchSize).Parallel()
+	drain := func(f func(*batch) error) func(reflect.Value) error {
+		return func(value reflect.Value) error {
+			if value.Kind() == reflect.Bool {
+				return nil
+			}
+			b, err := tableBatch(value.Interface().(*tables.Table), features, label, test, valid, batchSize)
+			if err != nil {
+				return err
+			}
+			return f(b)
+		}
+	}
+	return feed{
+		train: func(f func(*batch) error) error { return train.Drain(drain(f)) },
+		eval:  func(f func(*batch) error) error { return full.Drain(drain(f)) },
+		test:  func(f func(*batch) error) error { return tested.Drain(drain(f)) },
+	}
+}
+
+/*
+evaluate calls f with network output and loss for every batch, it returns ctx.Err() if context is done
+*/
+func (network *Network) evaluate(ctx context.Context, batches func(func(*batch) error) error, f func(b *batch, out, loss []float32)) error {
+	out := make([]float32, network.Graph.Output.Dim().Total())
+	loss := make([]float32, network.Graph.Loss.Dim().Total())
+	return batches(func(b *batch) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		network.Label.SetValues(b.labels)
+		network.Forward(b.features, out)
+		network.Loss.CopyValuesTo(loss)
+		f(b, out, loss)
+		return nil
+	})
+}
+
+/*
+subsample returns iteration over randomly chosen batches, the same batches are chosen on every iteration
+*/
+func subsample(batches func(func(*batch) error) error, frac float64, seed int) func(func(*batch) error) error {
+	return func(f func(*batch) error) error {
+		rng := rand.New(rand.NewSource(int64(seed)))
+		return batches(func(b *batch) error {
+			if rng.Float64() < frac {
+				return f(b)
+			}
+			return nil
+		})
+	}
+}
+
+/*
+passMetrics accumulates train metrics from network output and loss of trained batches
+*/
+type passMetrics struct {
+	mu        model.MetricsUpdater
+	out, loss []float32
+}
+
+func newPassMetrics(network *Network, mu model.MetricsUpdater) *passMetrics {
+	return &passMetrics{
+		mu:   mu,
+		out:  make([]float32, network.Graph.Output.Dim().Total()),
+		loss: make([]float32, network.Graph.Loss.Dim().Total()),
+	}
+}
+
+func (pm *passMetrics) update(network *Network, b *batch) {
+	network.Graph.Output.CopyValuesTo(pm.out)
+	network.Graph.Loss.CopyValuesTo(pm.loss)
+	resultCol := tables.MatrixColumn(pm.out, network.BatchSize)
+	l := pm.loss[0]
+	for i := 0; i < b.length; i++ {
+		if len(pm.loss) > 1 {
+			l = pm.loss[i]
+		}
+		pm.mu.Update(resultCol.Value(i), b.label(i), float64(l))
+	}
+}
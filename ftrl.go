@@ -0,0 +1,54 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+FTRL optimizer (Follow the Regularized Leader) useful for sparse models,
+Lambda1 is the L1 regularization strength
+*/
+type FTRL struct {
+	Lr, Lambda1, Beta, Decay float64
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type stFTRL struct {
+	Z, N *mx.NDArray
+}
+
+type implFTRL struct {
+	FTRL
+	scheduler
+	States map[*mx.NDArray]stFTRL
+}
+
+func (opt FTRL) Init(e int) Optimizer {
+	r := &implFTRL{FTRL: opt, States: make(map[*mx.NDArray]stFTRL)}
+	if r.Lambda1 == 0 {
+		r.Lambda1 = 0.01
+	}
+	if r.Beta == 0 {
+		r.Beta = 1
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.1, opt.Schedule)
+	return r
+}
+
+func (opt *implFTRL) Release() {
+	for _, v := range opt.States {
+		v.Z.Release()
+		v.N.Release()
+	}
+}
+
+func (opt *implFTRL) Update(params *mx.NDArray, grads *mx.NDArray) {
+	st, ok := opt.States[params]
+	if !ok {
+		st = stFTRL{Z: params.NewLikeThis().Zeros(), N: params.NewLikeThis().Zeros()}
+		opt.States[params] = st
+	}
+	mx.FtrlUpdate(params, grads, st.Z, st.N, opt.lr, opt.Lambda1, opt.Beta, opt.Decay)
+}
@@ -50,3 +50,26 @@ func (x Uniform) Inite(a *mx.NDArray) {
 	}
 	a.Uniform(0, magnitude)
 }
+
+/*
+RowNormOf initializes param by L2 norms of rows of param named Of,
+it's filled by ones when it's initialized standalone
+*/
+type RowNormOf struct {
+	Of string
+}
+
+func (x RowNormOf) Inite(a *mx.NDArray) {
+	a.Ones()
+}
+
+func (x RowNormOf) Derive(a *mx.NDArray, params map[string]*mx.NDArray) {
+	p, ok := params[x.Of]
+	if !ok {
+		x.Inite(a)
+		return
+	}
+	n := p.RowNorm()
+	defer n.Release()
+	a.CopyFrom(n)
+}
@@ -0,0 +1,66 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+LAMB is layer-wise adaptive Adam optimizer for large batch training,
+the step of every param is scaled by trust ratio ||w||/||step||
+*/
+type LAMB struct {
+	Lr, Beta1, Beta2, Epsilon, Decay float64
+	NoDecay                          []string
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type implLAMB struct {
+	LAMB
+	scheduler
+	States  map[*mx.NDArray]*stAdam
+	noDecay func(string) bool
+}
+
+func (opt LAMB) Init(e int) Optimizer {
+	r := &implLAMB{LAMB: opt, States: make(map[*mx.NDArray]*stAdam), noDecay: noDecay(opt.NoDecay)}
+	if r.Beta1 == 0 {
+		r.Beta1 = 0.9
+	}
+	if r.Beta2 == 0 {
+		r.Beta2 = 0.999
+	}
+	if r.Epsilon == 0 {
+		r.Epsilon = 1e-6
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.001, opt.Schedule)
+	return r
+}
+
+func (opt *implLAMB) Release() {
+	releaseAdamStates(opt.States)
+}
+
+func (opt *implLAMB) Update(params *mx.NDArray, grads *mx.NDArray) {
+	opt.UpdateNamed("", params, grads)
+}
+
+func (opt *implLAMB) UpdateNamed(name string, params *mx.NDArray, grads *mx.NDArray) {
+	d := adamDirection(opt.States, params, grads, opt.Beta1, opt.Beta2, opt.Epsilon)
+	defer d.Release()
+	if opt.Decay != 0 && !opt.noDecay(name) {
+		d.AddScaled(params, float32(opt.Decay))
+	}
+	params.AddScaled(d, -float32(opt.lr)*trustRatio(params.Norm(), d.Norm()))
+}
+
+/*
+trustRatio returns layer-wise trust ratio or 1 if any of norms is zero
+*/
+func trustRatio(wnorm, dnorm float32) float32 {
+	if wnorm > 0 && dnorm > 0 {
+		return wnorm / dnorm
+	}
+	return 1
+}
@@ -0,0 +1,70 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+LARS is layer-wise adaptive SGD with momentum for large batch training,
+the learning rate of every param is scaled by Eta*||w||/(||g||+Decay*||w||)
+*/
+type LARS struct {
+	Lr, Mom, Eta, Decay float64
+	NoDecay             []string
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type implLARS struct {
+	LARS
+	scheduler
+	States  map[*mx.NDArray]*mx.NDArray
+	noDecay func(string) bool
+}
+
+func (opt LARS) Init(e int) Optimizer {
+	r := &implLARS{LARS: opt, States: make(map[*mx.NDArray]*mx.NDArray), noDecay: noDecay(opt.NoDecay)}
+	if r.Mom == 0 {
+		r.Mom = 0.9
+	}
+	if r.Eta == 0 {
+		r.Eta = 0.001
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.1, opt.Schedule)
+	return r
+}
+
+func (opt *implLARS) Release() {
+	for _, v := range opt.States {
+		v.Release()
+	}
+}
+
+func (opt *implLARS) Update(params *mx.NDArray, grads *mx.NDArray) {
+	opt.UpdateNamed("", params, grads)
+}
+
+func (opt *implLARS) UpdateNamed(name string, params *mx.NDArray, grads *mx.NDArray) {
+	mom, ok := opt.States[params]
+	if !ok {
+		mom = params.NewLikeThis().Zeros()
+		opt.States[params] = mom
+	}
+	decay := float32(opt.Decay)
+	if opt.noDecay(name) {
+		decay = 0
+	}
+	wnorm, gnorm := params.Norm(), grads.Norm()
+	lr := float32(opt.lr)
+	if wnorm > 0 && gnorm > 0 {
+		lr *= float32(opt.Eta) * wnorm / (gnorm + decay*wnorm)
+	}
+	g := grads.Clone()
+	defer g.Release()
+	if decay != 0 {
+		g.AddScaled(params, decay)
+	}
+	mom.MulScalar(float32(opt.Mom)).AddScaled(g, lr)
+	params.Sub(mom)
+}
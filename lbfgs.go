@@ -0,0 +1,223 @@
+package nn
+
+import (
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/nn/mx"
+	"math"
+)
+
+/*
+FullBatchOptimizer is a ClosureOptimizer minimizing loss over the whole training data,
+the training makes one optimizer step per epoch with closure calculating loss and gradients
+over all training batches
+*/
+type FullBatchOptimizer interface {
+	ClosureOptimizer
+	FullBatch()
+}
+
+/*
+LBFGS is the full batch L-BFGS optimizer with backtracking line search for small networks,
+it makes up to MaxIter iterations per epoch over flattened vector of all trained params.
+Lr is the initial step of line search and is 1 by default, History is 10, MaxIter is 20 and Tolerance is 1e-7 by default.
+Param constraints are applied after all iterations
+*/
+type LBFGS struct {
+	Lr        float64
+	History   int
+	MaxIter   int
+	Tolerance float64
+}
+
+type implLBFGS struct {
+	LBFGS
+	s, y [][]float64
+	rho  []float64
+}
+
+func (opt LBFGS) Init(e int) Optimizer {
+	r := &implLBFGS{LBFGS: opt}
+	r.Lr = fnzf(r.Lr, 1)
+	r.Tolerance = fnzf(r.Tolerance, 1e-7)
+	if r.History <= 0 {
+		r.History = 10
+	}
+	if r.MaxIter <= 0 {
+		r.MaxIter = 20
+	}
+	return r
+}
+
+func (opt *implLBFGS) Release() {}
+
+/*
+saveState writes history of updates as matrices with row for every update
+*/
+func (opt *implLBFGS) saveState(_ *Network, put func(string, mx.Dimension, interface{})) {
+	if len(opt.s) == 0 {
+		return
+	}
+	dim := mx.Dim(len(opt.s), len(opt.s[0]))
+	s, y := make([]float64, 0, dim.Total()), make([]float64, 0, dim.Total())
+	for i := range opt.s {
+		s, y = append(s, opt.s[i]...), append(y, opt.y[i]...)
+	}
+	put("s", dim, s)
+	put("y", dim, y)
+	put("rho", mx.Dim(len(opt.rho)), append([]float64{}, opt.rho...))
+}
+
+func (opt *implLBFGS) loadState(_ *Network, get func(string) (mx.Dimension, interface{}, bool)) {
+	dim, s, ok := get("s")
+	_, y, ok1 := get("y")
+	_, rho, ok2 := get("rho")
+	if !ok || !ok1 || !ok2 || dim.Len != 2 {
+		return
+	}
+	opt.s, opt.y, opt.rho = nil, nil, rho.([]float64)
+	for i := 0; i < dim.Shape[0]; i++ {
+		j := i * dim.Shape[1]
+		opt.s = append(opt.s, s.([]float64)[j:j+dim.Shape[1]])
+		opt.y = append(opt.y, y.([]float64)[j:j+dim.Shape[1]])
+	}
+}
+
+func (opt *implLBFGS) FullBatch() {}
+
+/*
+Update makes plain gradient descent step, L-BFGS step is made by Minimize
+*/
+func (opt *implLBFGS) Update(params *mx.NDArray, grads *mx.NDArray) {
+	mx.SgdUpdate(params, grads, opt.Lr, 0)
+}
+
+func dot(a, b []float64) (r float64) {
+	for i, v := range a {
+		r += v * b[i]
+	}
+	return
+}
+
+/*
+direction returns L-BFGS search direction calculated by two-loop recursion
+*/
+func (opt *implLBFGS) direction(g []float64) []float64 {
+	q := append([]float64{}, g...)
+	alpha := make([]float64, len(opt.s))
+	for i := len(opt.s) - 1; i >= 0; i-- {
+		alpha[i] = opt.rho[i] * dot(opt.s[i], q)
+		for j := range q {
+			q[j] -= alpha[i] * opt.y[i][j]
+		}
+	}
+	if n := len(opt.s); n > 0 {
+		gamma := dot(opt.s[n-1], opt.y[n-1]) / dot(opt.y[n-1], opt.y[n-1])
+		for j := range q {
+			q[j] *= gamma
+		}
+	}
+	for i := range opt.s {
+		b := opt.rho[i] * dot(opt.y[i], q)
+		for j := range q {
+			q[j] += opt.s[i][j] * (alpha[i] - b)
+		}
+	}
+	for j := range q {
+		q[j] = -q[j]
+	}
+	return q
+}
+
+func (opt *implLBFGS) Minimize(network *Network, closure func() float32) {
+	names := fu.SortedKeysOf(network.Graph.Grads).([]string)
+	// flat vectors are float64, so values of Float64 params are kept without loss
+	flatten := func(m map[string]*mx.NDArray) []float64 {
+		r := []float64{}
+		for _, n := range names {
+			r = append(r, m[n].Values(mx.Float64).([]float64)...)
+		}
+		return r
+	}
+	assign := func(x []float64) {
+		for _, n := range names {
+			p := network.Graph.Params[n]
+			total := p.Dim().Total()
+			if p.Dtype() == mx.Float64 {
+				p.SetValues(x[:total])
+			} else {
+				v := make([]float32, total)
+				for i := range v {
+					v[i] = float32(x[i])
+				}
+				p.SetValues(v)
+			}
+			x = x[total:]
+		}
+	}
+	eval := func(x []float64) (float64, []float64) {
+		assign(x)
+		return float64(closure()), flatten(network.Graph.Grads)
+	}
+
+	x := flatten(network.Graph.Params)
+	f, g := float64(closure()), flatten(network.Graph.Grads)
+	for it := 0; it < opt.MaxIter; it++ {
+		gmax := 0.
+		for _, v := range g {
+			gmax = math.Max(gmax, math.Abs(v))
+		}
+		if gmax <= opt.Tolerance {
+			break
+		}
+		d := opt.direction(g)
+		gd := dot(g, d)
+		if gd > -1e-12 {
+			opt.s, opt.y, opt.rho = nil, nil, nil
+			d = opt.direction(g)
+			gd = dot(g, d)
+		}
+		t := opt.Lr
+		if len(opt.s) == 0 {
+			l1 := 0.
+			for _, v := range g {
+				l1 += math.Abs(v)
+			}
+			t = math.Min(1, 1/l1) * opt.Lr
+		}
+		xn := make([]float64, len(x))
+		var fn float64
+		var gn []float64
+		ok := false
+		for ls := 0; ls < 20 && !ok; ls++ {
+			for j := range x {
+				xn[j] = x[j] + t*d[j]
+			}
+			fn, gn = eval(xn)
+			if ok = fn <= f+1e-4*t*gd; !ok {
+				t *= 0.5
+			}
+		}
+		if !ok {
+			eval(x)
+			break
+		}
+		s := make([]float64, len(x))
+		y := make([]float64, len(x))
+		for j := range x {
+			s[j] = xn[j] - x[j]
+			y[j] = gn[j] - g[j]
+		}
+		if sy := dot(s, y); sy > 1e-10 {
+			opt.s, opt.y, opt.rho = append(opt.s, s), append(opt.y, y), append(opt.rho, 1/sy)
+			if len(opt.s) > opt.History {
+				opt.s, opt.y, opt.rho = opt.s[1:], opt.y[1:], opt.rho[1:]
+			}
+		}
+		converged := math.Abs(f-fn) <= opt.Tolerance*math.Max(1, math.Abs(f))
+		x, f, g = xn, fn, gn
+		if converged {
+			break
+		}
+	}
+	network.constrain()
+}
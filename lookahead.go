@@ -0,0 +1,160 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+wrapped is the base of optimizers wrapping another optimizer,
+it delegates scheduling, release and update of params to the wrapped optimizer
+*/
+type wrapped struct {
+	inner Optimizer
+}
+
+func (w wrapped) optimizerOf(string) Optimizer {
+	return w.inner
+}
+
+func (w wrapped) nested() []Optimizer {
+	return []Optimizer{w.inner}
+}
+
+func (w wrapped) Release() {
+	w.inner.Release()
+}
+
+func (w wrapped) Update(params *mx.NDArray, grads *mx.NDArray) {
+	w.inner.Update(params, grads)
+}
+
+func (w wrapped) Epoch(epoch int) {
+	if so, ok := w.inner.(ScheduledOptimizer); ok {
+		so.Epoch(epoch)
+	}
+}
+
+func (w wrapped) Step(step int) {
+	if so, ok := w.inner.(ScheduledOptimizer); ok {
+		so.Step(step)
+	}
+}
+
+func (w wrapped) setLr(lr float64) bool {
+	if ls, ok := w.inner.(lrSetter); ok {
+		return ls.setLr(lr)
+	}
+	return false
+}
+
+func (w wrapped) CurrentLr() float64 {
+	if so, ok := w.inner.(ScheduledOptimizer); ok {
+		return so.CurrentLr()
+	}
+	return 0
+}
+
+/*
+update makes the step of wrapped optimizer
+*/
+func (w wrapped) update(network *Network, closure func() float32) {
+	if co, ok := w.inner.(ClosureOptimizer); ok {
+		co.Minimize(network, closure)
+	} else {
+		network.UpdateParams(w.inner)
+	}
+}
+
+/*
+Lookahead optimizer keeps slow weights moving to fast weights updated by Optimizer,
+every K steps slow weights are moved by Alpha to fast weights and fast weights are reset to slow ones.
+K is 5 and Alpha is 0.5 by default
+*/
+type Lookahead struct {
+	Optimizer OptimizerConf
+	K         int
+	Alpha     float64
+}
+
+type implLookahead struct {
+	wrapped
+	Lookahead
+	count int
+	slow  map[*mx.NDArray]*mx.NDArray
+}
+
+func (opt Lookahead) Init(e int) Optimizer {
+	r, err := opt.initOptimizer(e)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+func (opt Lookahead) initOptimizer(e int) (Optimizer, error) {
+	o, err := NewOptimizer(opt.Optimizer, e)
+	if err != nil {
+		return nil, err
+	}
+	r := &implLookahead{wrapped: wrapped{o}, Lookahead: opt, slow: map[*mx.NDArray]*mx.NDArray{}}
+	if r.K <= 0 {
+		r.K = 5
+	}
+	r.Alpha = fnzf(r.Alpha, 0.5)
+	return r, nil
+}
+
+func (opt *implLookahead) Release() {
+	for _, v := range opt.slow {
+		v.Release()
+	}
+	opt.wrapped.Release()
+}
+
+func (opt *implLookahead) Minimize(network *Network, closure func() float32) {
+	for k := range network.Graph.Grads {
+		p := network.Graph.Params[k]
+		if _, ok := opt.slow[p]; !ok {
+			opt.slow[p] = p.Clone()
+		}
+	}
+	opt.update(network, closure)
+	if opt.count++; opt.count%opt.K == 0 {
+		for p, s := range opt.slow {
+			p.CopyFrom(s.Lerp(p, float32(opt.Alpha)))
+		}
+	}
+}
+
+/*
+saveState writes count of steps and slow weights by names of params,
+slow weights of Float16 network are kept for master params updated by optimizer
+*/
+func (opt *implLookahead) saveState(network *Network, put func(string, mx.Dimension, interface{})) {
+	put("count", mx.Dim(1), []float64{float64(opt.count)})
+	for n := range network.Params {
+		if s, ok := opt.slow[network.param(n)]; ok {
+			dim, v := arrayValue(s)
+			put("slow$"+n, dim, v)
+		}
+	}
+}
+
+func (opt *implLookahead) loadState(network *Network, get func(string) (mx.Dimension, interface{}, bool)) {
+	if _, v, ok := get("count"); ok {
+		opt.count = int(firstValue(v))
+	}
+	for n := range network.Params {
+		p := network.param(n)
+		dim, v, ok := get("slow$" + n)
+		if !ok || dim != p.Dim() {
+			continue
+		}
+		s, ok := opt.slow[p]
+		if !ok {
+			s = p.Clone()
+			opt.slow[p] = s
+		}
+		s.SetValues(v)
+	}
+}
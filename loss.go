@@ -56,3 +56,44 @@ type LossFunc func(*mx.Symbol) *mx.Symbol
 func (loss LossFunc) Loss(out *mx.Symbol) *mx.Symbol {
 	return loss(out)
 }
+
+/*
+RankNetLoss is the pairwise logistic ranking loss.
+Network output is expected to be a single score per row
+and label is a pair (relevance, group) which is prepared by Train when Model.Group is specified.
+Only pairs of rows from the same group having different relevance are taken into account
+*/
+type RankNetLoss struct{}
+
+func (RankNetLoss) Loss(out *mx.Symbol) *mx.Symbol {
+	label := mx.Var("_label", mx.Dim(0, 2))
+	rel := mx.Slice(label, 1, 0, 1)
+	grp := mx.Slice(label, 1, 1, 2)
+	s := mx.BcastSub(out, mx.Transpose(out))
+	pairs := mx.Mul(
+		mx.BcastEqual(grp, mx.Transpose(grp)),
+		mx.Greater(mx.BcastSub(rel, mx.Transpose(rel)), 0))
+	a := mx.Mul(pairs, mx.Activation(mx.Minus(s), mx.ActivSoftReLU))
+	return mx.BcastDiv(mx.Sum(a, 1), mx.Add(mx.Sum(pairs), 1e-12))
+}
+
+/*
+ListNetLoss is the listwise (top one probability) ranking loss,
+it's a cross entropy of softmax over scores and softmax over relevance inside every group.
+Network output is expected to be a single score per row
+and label is a pair (relevance, group) which is prepared by Train when Model.Group is specified
+*/
+type ListNetLoss struct{}
+
+func (ListNetLoss) Loss(out *mx.Symbol) *mx.Symbol {
+	label := mx.Var("_label", mx.Dim(0, 2))
+	rel := mx.Slice(label, 1, 0, 1)
+	grp := mx.Slice(label, 1, 1, 2)
+	m := mx.BcastEqual(grp, mx.Transpose(grp))
+	es := mx.Exp(out)
+	er := mx.Exp(rel)
+	ps := mx.Div(es, mx.Dot(m, es))
+	pr := mx.Div(er, mx.Dot(m, er))
+	a := mx.Mul(mx.Mul(pr, mx.Log(mx.Add(ps, 1e-12))), mx.GE(grp, 0))
+	return mx.Sum(mx.Mul(a, -1), -1)
+}
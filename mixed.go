@@ -0,0 +1,120 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"math"
+)
+
+const initialLossScale = 1024
+
+// loss is scaled in forward pass too, so Float16 scaled loss should not overflow
+const maxLossScale = 8192
+
+// loss scale is doubled after lossScaleWindow steps without gradients overflow
+const lossScaleWindow = 2000
+
+/*
+mixedPrecision keeps Float32 master copies of trained params of Float16 network.
+Optimizer updates master params by unscaled Float32 gradients and Float16 params are copied from master ones.
+The loss scale is halved and the step is skipped when scaled gradients overflow
+*/
+type mixedPrecision struct {
+	master map[string]*mx.NDArray
+	grads  map[string]*mx.NDArray
+	scale  float32
+	good   int
+}
+
+func newMixedPrecision(network *Network) *mixedPrecision {
+	m := &mixedPrecision{
+		master: map[string]*mx.NDArray{},
+		grads:  map[string]*mx.NDArray{},
+	}
+	for n := range network.Graph.Autograd {
+		m.master[n] = network.Graph.Ctx.CopyAs(network.Graph.Params[n], mx.Float32)
+	}
+	m.setScale(network, initialLossScale)
+	return m
+}
+
+func (m *mixedPrecision) Release() {
+	for _, a := range m.master {
+		a.Release()
+	}
+	for _, a := range m.grads {
+		a.Release()
+	}
+	m.master = nil
+	m.grads = nil
+}
+
+func (m *mixedPrecision) setScale(network *Network, scale float32) {
+	m.scale = scale
+	if s, ok := network.Graph.Params[mx.LossScaleName]; ok {
+		s.Fill(scale)
+	}
+}
+
+/*
+unscale copies Float16 gradients to Float32 ones divided by loss scale
+and returns false if gradients are overflowed
+*/
+func (m *mixedPrecision) unscale(network *Network, grads map[string]*mx.NDArray) bool {
+	finite := true
+	for n, g := range grads {
+		a, ok := m.grads[n]
+		if !ok {
+			a = network.Graph.Ctx.Array(mx.Float32, g.Dim())
+			m.grads[n] = a
+		}
+		a.CopyFrom(g).MulScalar(1 / m.scale)
+		if v := float64(a.Norm()); math.IsNaN(v) || math.IsInf(v, 0) {
+			finite = false
+		}
+	}
+	return finite
+}
+
+func (m *mixedPrecision) sync(params map[string]*mx.NDArray) {
+	for n, a := range m.master {
+		params[n].CopyFrom(a)
+	}
+}
+
+/*
+update makes optimizer step over master params and copies them to Float16 params
+*/
+func (m *mixedPrecision) update(network *Network, opt Optimizer) {
+	params, grads := network.Graph.Params, network.Graph.Grads
+	if !m.unscale(network, grads) {
+		if m.scale > 1 {
+			m.setScale(network, m.scale/2)
+		}
+		m.good = 0
+		return
+	}
+	if m.good++; m.good >= lossScaleWindow && m.scale < maxLossScale {
+		m.setScale(network, m.scale*2)
+		m.good = 0
+	}
+	mp := make(map[string]*mx.NDArray, len(params))
+	for n, p := range params {
+		if a, ok := m.master[n]; ok {
+			p = a
+		}
+		mp[n] = p
+	}
+	mg := make(map[string]*mx.NDArray, len(grads))
+	for n := range grads {
+		mg[n] = m.grads[n]
+	}
+	network.Graph.Params, network.Graph.Grads = mp, mg
+	network.update(opt, func() float32 {
+		m.sync(params)
+		l := network.Closure()
+		m.unscale(network, grads)
+		return l
+	})
+	network.Graph.Params, network.Graph.Grads = params, grads
+	m.sync(params)
+}
@@ -1,6 +1,7 @@
 package nn
 
 import (
+	"context"
 	"go4ml.xyz/base/fu"
 	"go4ml.xyz/base/model"
 	"go4ml.xyz/base/tables"
@@ -10,6 +11,7 @@ import (
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
 	"io"
+	"time"
 )
 
 // default batch size for general nn training
@@ -27,6 +29,86 @@ type Model struct {
 	BatchSize int
 	Predicted string
 	Context   mx.Context // CPU by default
+
+	// Dtype is type of network params and activations, Float32 by default.
+	// Float16 network is trained with Float32 master params and dynamic loss scaling,
+	// params are memorized as Float32 for Float16 network and as Float64 for Float64 one
+	Dtype mx.Dtype
+
+	// Group is a column with query/group ID used by ranking losses,
+	// when specified batches are aligned to groups of rows
+	Group  string
+	NdcgAt int // k for NDCG@k metric reported when Group is specified, 10 by default
+
+	// Validation is a flag column of validation rows excluded from training,
+	// validation metrics are reported as test ones and used to choose the best epoch and to stop early.
+	// Test rows are evaluated once after training and reported in Report.Test if dataset has them
+	Validation string
+
+	// TrainPassMetrics makes train metrics accumulated from network output on training pass
+	// instead of evaluation of training rows after the epoch, so only test rows are evaluated.
+	// It's ignored with full batch optimizer and privacy
+	TrainPassMetrics bool
+	// EvalEvery is count of epochs between evaluations, model is memorized only on evaluated epochs.
+	// The last epoch and the epoch stopped by callback are always evaluated
+	EvalEvery int
+	// EvalSubsample is fraction of randomly chosen batches evaluated every epoch,
+	// the same batches are evaluated on every epoch
+	EvalSubsample float64
+
+	// Sampling defines order of training rows, rows are ordered again every epoch using Seed.
+	// It's not supported with Group
+	Sampling Sampling
+	// ShuffleBuffer is count of rows shuffled at once by Shuffled sampling of streamed dataset,
+	// all training rows are shuffled if it's not specified
+	ShuffleBuffer int
+
+	// Trainable are patterns of params to train, other params are frozen.
+	// Patterns are matched like in Network.SaveParams, all params are trained if there are no patterns
+	Trainable []string
+	// Unfreeze maps epoch to patterns of params to be unfrozen starting from this epoch
+	Unfreeze map[int][]string
+
+	// Pretrained is a model written by Memorize, network params having the same name and shape
+	// are initialized by values of pretrained params
+	Pretrained iokit.Input
+	// PretrainedNames maps names of pretrained params or layers to network names, empty name skips param
+	PretrainedNames map[string]string
+
+	// gradients are clipped before optimizer step, they can't be clipped for full batch optimizers like LBFGS
+	ClipValue      float32 // clips every gradient value to [-ClipValue,ClipValue]
+	ClipGlobalNorm float32 // scales gradients to have global norm over all gradients not greater than ClipGlobalNorm
+
+	// AccumulateSteps is count of batches gradients are summed over before optimizer step,
+	// so the effective batch size is BatchSize*AccumulateSteps.
+	// Gradients of the last batches of epoch are applied at the epoch end even if there are less of them
+	AccumulateSteps int
+
+	// Average is EMA or SWA averaging of params,
+	// averaged params are used to evaluate network and are memorized with the model
+	Average Averaging
+
+	// Privacy enables differentially private training by DP-SGD,
+	// it's not supported for Float16 networks, networks having BatchNorm,
+	// gradients accumulation and full batch optimizers
+	Privacy *DP
+
+	// EarlyStop stops training when test metric is not improved,
+	// the model is memorized with params of the best epoch
+	EarlyStop *EarlyStopping
+
+	// Checkpoint writes training state every Checkpoint.Every evaluated epochs.
+	// Dropout and sampling are seeded by epoch when training is checkpointed or resumed
+	Checkpoint *Checkpoint
+	// Resume is a checkpoint training continues from, history of checkpointed epochs is passed to workout again
+	// without memorizing models which are memorized by the interrupted training
+	Resume iokit.Input
+
+	// TimeBudget is duration of training, training is interrupted when it's spent
+	TimeBudget time.Duration
+
+	// Callbacks are notified about training progress and can stop training or change learning rate
+	Callbacks []Callback
 }
 
 func (e Model) Feed(ds model.Dataset) model.FatModel {
@@ -35,6 +117,15 @@ func (e Model) Feed(ds model.Dataset) model.FatModel {
 	}
 }
 
+/*
+FeedWithContext returns model trained until context is done, see TrainWithContext
+*/
+func (e Model) FeedWithContext(ctx context.Context, ds model.Dataset) model.FatModel {
+	return func(workout model.Workout) (*model.Report, error) {
+		return TrainWithContext(ctx, e, ds, workout, DefaultModelMap)
+	}
+}
+
 /*
 PredictionModel is the FeaturesMapper factory
 */
@@ -91,23 +182,35 @@ type FeaturesMapper struct {
 
 /*
 MapFeature returns new table with all original columns except features
-adding one new column with prediction/calculation
+adding one new column with prediction/calculation,
+table longer than network batch is mapped by chunks of batch size
 */
 func (fm *FeaturesMapper) MapFeatures(t *tables.Table) (r *tables.Table, err error) {
 	var input tables.Matrix
-	if input, err = t.Matrix(fm.model.features, fm.network.BatchSize); err != nil {
+	if input, err = t.Matrix(fm.model.features, t.Len()); err != nil {
 		return
 	}
-	out := make([]float32, fm.network.Output.Dim().Total())
-	outWidth := fm.network.Output.Dim().Total() / fm.network.BatchSize
 	if input.Width != fm.network.Input.Dim().Total()/fm.network.BatchSize {
 		return nil, xerrors.Errorf("features does not fit network input")
 	}
-	if t.Len() > fm.network.BatchSize {
-		return nil, xerrors.Errorf("batch size does not fit network input")
+	bs := fm.network.BatchSize
+	out := make([]float32, fm.network.Output.Dim().Total())
+	outWidth := len(out) / bs
+	result := make([]float32, outWidth*t.Len())
+	data := make([]float32, input.Width*bs)
+	for from := 0; from < t.Len(); from += bs {
+		n := t.Len() - from
+		if n > bs {
+			n = bs
+		}
+		copy(data, input.Features[from*input.Width:(from+n)*input.Width])
+		for i := n * input.Width; i < len(data); i++ {
+			data[i] = 0
+		}
+		fm.network.Forward(data, out)
+		copy(result[from*outWidth:], out[:n*outWidth])
 	}
-	fm.network.Forward(input.Features, out)
-	return t.Except(fm.model.features...).With(tables.MatrixColumn(out[0:outWidth*t.Len()], t.Len()), fm.model.predicts), nil
+	return t.Except(fm.model.features...).With(tables.MatrixColumn(result, t.Len()), fm.model.predicts), nil
 }
 
 /*
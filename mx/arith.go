@@ -0,0 +1,156 @@
+package mx
+
+import (
+	"go4ml.xyz/nn/mx/capi"
+	"math"
+)
+
+func (a *NDArray) ReLU() *NDArray {
+	capi.ImperativeInvokeInOut1(capi.OpReLU, a.handle, a.handle)
+	return a
+}
+
+func (a *NDArray) Clip(low, high float32) *NDArray {
+	capi.ImperativeInvokeInOut1(
+		capi.OpClip,
+		a.handle,
+		a.handle,
+		capi.KeyAMin, low,
+		capi.KeyAMax, high)
+	return a
+}
+
+/*
+RowNorm returns new array with L2 norms of array rows
+i.e. the norm over all axes except the first one, dimensions are kept
+*/
+func (a *NDArray) RowNorm() *NDArray {
+	if a.dim.Len < 2 {
+		n := a.NewLikeThis()
+		capi.ImperativeInvokeInOut1(capi.OpAbs, a.handle, n.handle)
+		return n
+	}
+	sq := a.NewLikeThis()
+	defer sq.Release()
+	capi.ImperativeInvokeInOut1(capi.OpSquare, a.handle, sq.handle)
+	d := a.dim
+	axis := make([]int, 0, d.Len-1)
+	for i := 1; i < d.Len; i++ {
+		d.Shape[i] = 1
+		axis = append(axis, i)
+	}
+	n := a.ctx.Array(a.dtype, d)
+	capi.ImperativeInvokeInOut1(
+		capi.OpSum,
+		sq.handle,
+		n.handle,
+		capi.KeyAxis, formatAxis(axis...),
+		capi.KeyKeepdims, 1)
+	capi.ImperativeInvokeInOut1(capi.OpSqrt, n.handle, n.handle)
+	return n
+}
+
+/*
+Renorm scales rows of array having L2 norm greater than maxnorm to have norm equal to maxnorm,
+if exact is true all rows are scaled to have norm equal to maxnorm
+*/
+func (a *NDArray) Renorm(maxnorm float32, exact bool) *NDArray {
+	n := a.RowNorm()
+	defer n.Release()
+	s := n.NewLikeThis()
+	defer s.Release()
+	if exact {
+		s.Fill(maxnorm)
+	} else {
+		capi.ImperativeInvokeInOut1(
+			capi.OpClip,
+			n.handle,
+			s.handle,
+			capi.KeyAMin, 0,
+			capi.KeyAMax, maxnorm)
+	}
+	capi.ImperativeInvokeInOut1(capi.OpAddScalar, n.handle, n.handle, capi.KeyScalar, 1e-7)
+	capi.ImperativeInvokeInOutN(capi.OpDiv, s.handle, []capi.NDArrayHandle{s.handle, n.handle})
+	capi.ImperativeInvokeInOutN(capi.OpBroadcastMul, a.handle, []capi.NDArrayHandle{a.handle, s.handle})
+	return a
+}
+
+func (a *NDArray) inplace(op capi.MxnetOp, b *NDArray) *NDArray {
+	capi.ImperativeInvokeInOutN(op, a.handle, []capi.NDArrayHandle{a.handle, b.handle})
+	return a
+}
+
+// Add adds b to array elementwise
+func (a *NDArray) Add(b *NDArray) *NDArray { return a.inplace(capi.OpAdd, b) }
+
+// Sub subtracts b from array elementwise
+func (a *NDArray) Sub(b *NDArray) *NDArray { return a.inplace(capi.OpSub, b) }
+
+// Mul multiplies array by b elementwise
+func (a *NDArray) Mul(b *NDArray) *NDArray { return a.inplace(capi.OpMul, b) }
+
+// Div divides array by b elementwise
+func (a *NDArray) Div(b *NDArray) *NDArray { return a.inplace(capi.OpDiv, b) }
+
+func (a *NDArray) AddScalar(v float32) *NDArray {
+	capi.ImperativeInvokeInOut1(capi.OpAddScalar, a.handle, a.handle, capi.KeyScalar, v)
+	return a
+}
+
+func (a *NDArray) MulScalar(v float32) *NDArray {
+	capi.ImperativeInvokeInOut1(capi.OpMulScalar, a.handle, a.handle, capi.KeyScalar, v)
+	return a
+}
+
+func (a *NDArray) Square() *NDArray {
+	capi.ImperativeInvokeInOut1(capi.OpSquare, a.handle, a.handle)
+	return a
+}
+
+func (a *NDArray) Sqrt() *NDArray {
+	capi.ImperativeInvokeInOut1(capi.OpSqrt, a.handle, a.handle)
+	return a
+}
+
+/*
+CopyFrom copies values of b into array having the same shape
+*/
+func (a *NDArray) CopyFrom(b *NDArray) *NDArray {
+	capi.ImperativeInvokeInOut1(capi.OpCopyTo, b.handle, a.handle)
+	return a
+}
+
+/*
+Clone returns new array with the same values
+*/
+func (a *NDArray) Clone() *NDArray {
+	return a.NewLikeThis().CopyFrom(a)
+}
+
+/*
+AddScaled adds b multiplied by k to array elementwise
+*/
+func (a *NDArray) AddScaled(b *NDArray, k float32) *NDArray {
+	t := b.Clone()
+	defer t.Release()
+	return a.Add(t.MulScalar(k))
+}
+
+/*
+Lerp moves array to b by k i.e. a = (1-k)*a + k*b
+*/
+func (a *NDArray) Lerp(b *NDArray, k float32) *NDArray {
+	return a.MulScalar(1-k).AddScaled(b, k)
+}
+
+/*
+Norm returns L2 norm of all array values
+*/
+func (a *NDArray) Norm() float32 {
+	sq := a.Clone().Square()
+	defer sq.Release()
+	n := a.ctx.Array(a.dtype, Dim(1))
+	defer n.Release()
+	capi.ImperativeInvokeInOut1(capi.OpSum, sq.handle, n.handle)
+	return float32(math.Sqrt(float64(n.ValuesF32()[0])))
+}
@@ -199,6 +199,34 @@ func ImperativeInvokeInOut1(op MxnetOp, h NDArrayHandle, o NDArrayHandle, a ...i
 	}
 }
 
+func ImperativeInvokeInOutN(op MxnetOp, out NDArrayHandle, in []NDArrayHandle, a ...interface{}) {
+	if out == nil {
+		panic("uninitialized or broken output array")
+	}
+	if len(in) > 6 {
+		panic("too many input arrays")
+	}
+
+	var h [6]NDArrayHandle
+	for i, v := range in {
+		if v == nil {
+			panic("uninitialized or broken input array")
+		}
+		h[i] = v
+	}
+
+	var keys [MaxArgsCount]*C.char
+	var vals [MaxArgsCount]*C.char
+	ano := C.int(Fillargs(keys[:], vals[:], a))
+	if ent := mxentry[op]; ent != nil {
+		if e := C.imperative_invokeN_inout(ent, out, ano, &keys[0], &vals[0], h[0], h[1], h[2], h[3], h[4], h[5]); e != 0 {
+			panic(fmt.Sprintf("maxnet %v error: %v", op.Value(), mxLastError()))
+		}
+	} else {
+		panic(fmt.Sprintf("unresolved API entry %v", op.Value()))
+	}
+}
+
 func NewNDArrayHandle(devType int, devNo int, dtype int, shape [4]int, slen int) NDArrayHandle {
 	var a C.NDArrayHandle
 	s := [4]C.uint{C.uint(shape[0]), C.uint(shape[1]), C.uint(shape[2]), C.uint(shape[3])}
@@ -541,7 +569,7 @@ func OptimizerUpdate(op MxnetOp, params, grads, state1 NDArrayHandle, state2 NDA
 	var vals [MaxArgsCount]*C.char
 	ano := C.int(Fillargs(keys[:], vals[:], a))
 	if ent := mxentry[op]; ent != nil {
-		if e := C.imperative_invokeN_inout(ent, params, ano, &keys[0], &vals[0], params, grads, state1, state2); e != 0 {
+		if e := C.imperative_invokeN_inout(ent, params, ano, &keys[0], &vals[0], params, grads, state1, state2, nil, nil); e != 0 {
 			panic(fmt.Sprintf("mxnet api %v error: %v", op.Value(), mxLastError()))
 		}
 	} else {
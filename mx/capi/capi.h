@@ -114,12 +114,13 @@ static int imperative_invokeN_inout(
 	NDArrayHandle out,
 	int ano, const char **keys, const char **vals,
 	NDArrayHandle in0, NDArrayHandle in1,
-	NDArrayHandle in2, NDArrayHandle in3)
+	NDArrayHandle in2, NDArrayHandle in3,
+	NDArrayHandle in4, NDArrayHandle in5)
 {
 	int nin = 0;
 	NDArrayHandle* out1[1] = {&out};
-	NDArrayHandle inN[4] = {in0,in1,in2,in3};
-	for ( ;nin<4 && inN[nin]; ++nin) {}
+	NDArrayHandle inN[6] = {in0,in1,in2,in3,in4,in5};
+	for ( ;nin<6 && inN[nin]; ++nin) {}
 	int nout = 1;
 	int err = MXImperativeInvoke(ent, nin, inN, &nout, &out1[0], ano, keys, vals);
 	return err;
@@ -46,6 +46,12 @@ const (
 	KeyP
 	KeyDim1
 	KeyDim2
+	KeyAMin
+	KeyAMax
+	KeyGamma1
+	KeyGamma2
+	KeyLamda1
+	KeyBeta
 	KeyNoKey
 )
 
@@ -92,6 +98,12 @@ var keymap = map[MxnetKey]string{
 	KeyP:             "p",
 	KeyDim1:          "dim1",
 	KeyDim2:          "dim2",
+	KeyAMin:          "a_min",
+	KeyAMax:          "a_max",
+	KeyGamma1:        "gamma1",
+	KeyGamma2:        "gamma2",
+	KeyLamda1:        "lamda1",
+	KeyBeta:          "beta",
 }
 
 func (k MxnetKey) Value() string {
@@ -187,89 +199,101 @@ const (
 	OpDropout
 	OpExp
 	OpSwapAxis
+	OpBroadcastEqual
+	OpClip
+	OpBroadcastLike
+	OpRmspropUpdate
+	OpRmspropAlexUpdate
+	OpFtrlUpdate
 	OpNoOp
 )
 
 var opmap = map[MxnetOp]string{
-	OpRandomUniform:  "_random_uniform",
-	OpRandomNormal:   "_random_normal",
-	OpCopyTo:         "_copyto",
-	OpAdd:            "elemwise_add",
-	OpAddScalar:      "_plus_scalar",
-	OpSub:            "elemwise_sub",
-	OpSubScalar:      "_minus_scalar",
-	OpSubScalarR:     "_rminus_scalar",
-	OpMul:            "elemwise_mul",
-	OpMulScalar:      "_mul_scalar",
-	OpDiv:            "elemwise_div",
-	OpDivScalar:      "_div_scalar",
-	OpDivScalarR:     "_rdiv_scalar",
-	OpMean:           "mean",
-	OpStack:          "stack",
-	OpAbs:            "abs",
-	OpBlockGrad:      "BlockGrad",
-	OpMakeLoss:       "make_loss",
-	OpZeros:          "_zeros",
-	OpZerosLike:      "zeros_like",
-	OpOnes:           "_ones",
-	OpOnesLike:       "ones_like",
-	OpPowerScalar:    "_power_scalar",
-	OpPowerScalarR:   "_rpower_scalar",
-	OpSgdUpdate:      "sgd_update",
-	OpSgdMomUpdate:   "sgd_mom_update",
-	OpAdamUpdate:     "adam_update",
-	OpLogSoftmax:     "log_softmax",
-	OpSoftmax:        "softmax",
-	OpSoftmaxCE:      "softmax_cross_entropy",
-	OpSoftmaxAC:      "SoftmaxActivation",
-	OpSoftmaxOutput:  "SoftmaxOutput",
-	OpSum:            "sum",
-	OpSumNan:         "nansum",
-	OpDot:            "dot",
-	OpPick:           "pick",
-	OpSquare:         "square",
-	OpSqrt:           "sqrt",
-	OpConcat:         "Concat",
-	OpConvolution:    "Convolution",
-	OpActivation:     "Activation",
-	OpPooling:        "Pooling",
-	OpFullyConnected: "FullyConnected",
-	OpFlatten:        "Flatten",
-	OpNot:            "logical_not",
-	OpAnd:            "_logical_and",
-	OpOr:             "_logical_or",
-	OpXor:            "_logical_xor",
-	OpLog:            "log",
-	OpCosh:           "cosh",
-	OpSin:            "sin",
-	OpTanh:           "tanh",
-	OpSigmoid:        "sigmoid",
-	OpHardSigmoid:    "hard_sigmoid",
-	OpReLU:           "relu",
-	OpBroadcastSub:   "broadcast_sub",
-	OpBroadcastAdd:   "broadcast_add",
-	OpBroadcastMul:   "broadcast_mul",
-	OpBroadcastDiv:   "broadcast_div",
-	OpTranspose:      "transpose",
-	OpSlice:          "slice",
-	OpLe:             "_lesser_equal",
-	OpGe:             "_greater_equal",
-	OpNe:             "_not_equal",
-	OpEq:             "_equal",
-	OpLesser:         "_lesser",
-	OpGreater:        "_greater",
-	OpLeScalar:       "_lesser_equal_scalar",
-	OpGeScalar:       "_greater_equal_scalar",
-	OpNeScalar:       "_not_equal_scalar",
-	OpEqScalar:       "_equal_scalar",
-	OpLesserScalar:   "_lesser_scalar",
-	OpGreaterScalar:  "_greater_scalar",
-	OpReshape:        "Reshape",
-	OpReshapeLike:    "reshape_like",
-	OpBatchNorm:      "BatchNorm",
-	OpDropout:        "Dropout",
-	OpExp:            "exp",
-	OpSwapAxis:       "SwapAxis",
+	OpRandomUniform:     "_random_uniform",
+	OpRandomNormal:      "_random_normal",
+	OpCopyTo:            "_copyto",
+	OpAdd:               "elemwise_add",
+	OpAddScalar:         "_plus_scalar",
+	OpSub:               "elemwise_sub",
+	OpSubScalar:         "_minus_scalar",
+	OpSubScalarR:        "_rminus_scalar",
+	OpMul:               "elemwise_mul",
+	OpMulScalar:         "_mul_scalar",
+	OpDiv:               "elemwise_div",
+	OpDivScalar:         "_div_scalar",
+	OpDivScalarR:        "_rdiv_scalar",
+	OpMean:              "mean",
+	OpStack:             "stack",
+	OpAbs:               "abs",
+	OpBlockGrad:         "BlockGrad",
+	OpMakeLoss:          "make_loss",
+	OpZeros:             "_zeros",
+	OpZerosLike:         "zeros_like",
+	OpOnes:              "_ones",
+	OpOnesLike:          "ones_like",
+	OpPowerScalar:       "_power_scalar",
+	OpPowerScalarR:      "_rpower_scalar",
+	OpSgdUpdate:         "sgd_update",
+	OpSgdMomUpdate:      "sgd_mom_update",
+	OpAdamUpdate:        "adam_update",
+	OpLogSoftmax:        "log_softmax",
+	OpSoftmax:           "softmax",
+	OpSoftmaxCE:         "softmax_cross_entropy",
+	OpSoftmaxAC:         "SoftmaxActivation",
+	OpSoftmaxOutput:     "SoftmaxOutput",
+	OpSum:               "sum",
+	OpSumNan:            "nansum",
+	OpDot:               "dot",
+	OpPick:              "pick",
+	OpSquare:            "square",
+	OpSqrt:              "sqrt",
+	OpConcat:            "Concat",
+	OpConvolution:       "Convolution",
+	OpActivation:        "Activation",
+	OpPooling:           "Pooling",
+	OpFullyConnected:    "FullyConnected",
+	OpFlatten:           "Flatten",
+	OpNot:               "logical_not",
+	OpAnd:               "_logical_and",
+	OpOr:                "_logical_or",
+	OpXor:               "_logical_xor",
+	OpLog:               "log",
+	OpCosh:              "cosh",
+	OpSin:               "sin",
+	OpTanh:              "tanh",
+	OpSigmoid:           "sigmoid",
+	OpHardSigmoid:       "hard_sigmoid",
+	OpReLU:              "relu",
+	OpBroadcastSub:      "broadcast_sub",
+	OpBroadcastAdd:      "broadcast_add",
+	OpBroadcastMul:      "broadcast_mul",
+	OpBroadcastDiv:      "broadcast_div",
+	OpTranspose:         "transpose",
+	OpSlice:             "slice",
+	OpLe:                "_lesser_equal",
+	OpGe:                "_greater_equal",
+	OpNe:                "_not_equal",
+	OpEq:                "_equal",
+	OpLesser:            "_lesser",
+	OpGreater:           "_greater",
+	OpLeScalar:          "_lesser_equal_scalar",
+	OpGeScalar:          "_greater_equal_scalar",
+	OpNeScalar:          "_not_equal_scalar",
+	OpEqScalar:          "_equal_scalar",
+	OpLesserScalar:      "_lesser_scalar",
+	OpGreaterScalar:     "_greater_scalar",
+	OpReshape:           "Reshape",
+	OpReshapeLike:       "reshape_like",
+	OpBatchNorm:         "BatchNorm",
+	OpDropout:           "Dropout",
+	OpExp:               "exp",
+	OpSwapAxis:          "SwapAxis",
+	OpBroadcastEqual:    "broadcast_equal",
+	OpClip:              "clip",
+	OpBroadcastLike:     "broadcast_like",
+	OpRmspropUpdate:     "rmsprop_update",
+	OpRmspropAlexUpdate: "rmspropalex_update",
+	OpFtrlUpdate:        "ftrl_update",
 }
 
 func (o MxnetOp) Value() string {
@@ -30,15 +30,19 @@ type Graph struct {
 	Output *NDArray // referencing to Outputs["_output_output"]
 	Loss   *NDArray // referencing to Outputs["_loss_loss"]
 	Label  *NDArray // loss function label referencing to Params["_label"]
+	Mask   *NDArray // mask of rows trained by loss referencing to Params["_mask"]
 
 	Outputs  map[string]*NDArray  // referencing to executor outputs except loss
 	Params   map[string]*NDArray  // network parameters
 	Shapes   map[string]Dimension // predefined param shape
 	Autograd map[string]bool      // if param can be trained
+	Frozen   map[string]bool      // if param can be trained but is frozen now
 	Grads    map[string]*NDArray  // training gradients
 
 	Exec         capi.ExecutorHandle
 	Initializers map[string]Inite
+	Constraints  map[string]Constraint
+	Assigns      map[string]string // non-gradient variable => output assigned to it after training forward
 	Initialized  bool
 
 	symOut, symLast capi.SymbolHandle
@@ -52,6 +56,8 @@ type Graph struct {
 	outputs  map[string]*Symbol
 	refs     map[string]capi.SymbolHandle
 
+	penalties []*Symbol
+
 	symId int
 }
 
@@ -69,6 +75,7 @@ func (g *Graph) symRelease() {
 	g.alias = nil
 	g.refs = nil
 	g.outputs = nil
+	g.penalties = nil
 }
 
 func (g *Graph) Release() {
@@ -149,12 +156,13 @@ func (g *Graph) bind() {
 	grads := make([]capi.NDArrayHandle, len(names))
 	g.Input = g.Params["_input"]
 	g.Label = g.Params["_label"]
+	g.Mask = g.Params[MaskName]
 
 	for i, name := range names {
 		p := g.Params[name]
 		if p != nil {
 			args[i] = p.handle
-			if g.symLast != g.symOut && g.Autograd[name] {
+			if g.symLast != g.symOut && g.Autograd[name] && !g.Frozen[name] {
 				a := g.Ctx.Array(g.Dtype, p.Dim())
 				g.Grads[name] = a
 				grads[i] = a.handle
@@ -202,6 +210,7 @@ func Compose(
 		Params:       make(map[string]*NDArray),
 		Grads:        make(map[string]*NDArray),
 		Autograd:     make(map[string]bool),
+		Frozen:       make(map[string]bool),
 		Shapes:       make(map[string]Dimension),
 		symbols:      make(map[*Symbol]capi.SymbolHandle),
 		vars:         make(map[string]capi.SymbolHandle),
@@ -209,6 +218,8 @@ func Compose(
 		alias:        make(map[*Symbol]*Symbol),
 		outputs:      make(map[string]*Symbol),
 		Initializers: make(map[string]Inite),
+		Constraints:  make(map[string]Constraint),
+		Assigns:      make(map[string]string),
 	}
 
 	g.Input = ctx.Array(dtype, input)
@@ -221,12 +232,15 @@ func Compose(
 	out := last
 
 	if loss != nil {
-		symloss := loss.Loss(sym)
-		Loss := MakeLoss(symloss)
+		symloss := loss.Loss(maskGrads(sym))
+		Loss := MakeLoss(g.scaleLoss(symloss))
 		Loss.SetName("_loss")
 		_ = g.compose(symloss)
 		others := fu.ValsOf(g.outputs).([]*Symbol)
 		outs := append([]*Symbol{Out, Loss}, others...)
+		if p := g.penalty(); p != nil {
+			outs = append(outs, p)
+		}
 		out = g.compose(Group(outs...))
 		if len(others) > 0 {
 			outs := append([]*Symbol{Out}, others...)
@@ -249,6 +263,50 @@ func Compose(
 	return g
 }
 
+// name of output calculating the sum of all penalties of layers
+const PenaltyName = "_penalty"
+
+/*
+penalty returns the sum of all penalties as the additional loss
+*/
+func (g *Graph) penalty() *Symbol {
+	if len(g.penalties) == 0 {
+		return nil
+	}
+	p := g.penalties[0]
+	for _, v := range g.penalties[1:] {
+		p = Add(p, v)
+	}
+	return MakeLoss(g.scaleLoss(p)).SetName(PenaltyName)
+}
+
+// name of param masking rows of batch, gradients of masked out rows are zero and gradients of other rows are multiplied by mask
+const MaskName = "_mask"
+
+/*
+maskGrads returns symbol having the same value as network output but zero gradients of masked out rows
+*/
+func maskGrads(out *Symbol) *Symbol {
+	mask := Var(MaskName, Dim(0, 1), _Ones{})
+	masked := ReshapeLike(BcastMul(Reshape(out, 0, -1), mask), out)
+	return Add(masked, BlockGrad(Sub(out, masked)))
+}
+
+// name of Float16 network param keeping the current loss scale
+const LossScaleName = "_loss_scale"
+
+/*
+scaleLoss returns symbol having the same value as loss but gradients multiplied by loss scale
+when network is Float16, loss scale prevents underflow of small Float16 gradients
+*/
+func (g *Graph) scaleLoss(loss *Symbol) *Symbol {
+	if g.Dtype != Float16 {
+		return loss
+	}
+	scaled := BcastMul(loss, Value(LossScaleName, 1))
+	return Add(scaled, BlockGrad(Sub(loss, scaled)))
+}
+
 func (g *Graph) subcompose(s *Symbol) []capi.SymbolHandle {
 	var a []capi.SymbolHandle
 
@@ -293,8 +351,14 @@ func (g *Graph) compose(s *Symbol) capi.SymbolHandle {
 		if s.Init != nil {
 			g.Initializers[n] = s.Init
 		}
+		if s.Constraint != nil {
+			g.Constraints[n] = s.Constraint
+		}
 		if s.Op != OpNogVar_ && n[0] != '_' {
 			g.Autograd[n] = true
+			if s.Frozen {
+				g.Frozen[n] = true
+			}
 		}
 		if s.Dim.Len > 0 {
 			g.Shapes[n] = s.Dim.Like(g.Input.Dim())
@@ -312,6 +376,24 @@ func (g *Graph) compose(s *Symbol) capi.SymbolHandle {
 			_ = g.compose(v)
 		}
 		return h
+	case OpPenalty_:
+		for _, v := range s.Args[1:] {
+			known := false
+			for _, p := range g.penalties {
+				known = known || p == v
+			}
+			if !known {
+				g.penalties = append(g.penalties, v)
+			}
+		}
+		return g.compose(s.Args[0])
+	case OpAssign_:
+		n := "*" + s.Name + "$assign"
+		if _, ok := g.outputs[n]; !ok {
+			g.outputs[n] = BlockGrad(s.Args[1]).SetName(n)
+			g.Assigns[s.Name] = n
+		}
+		return g.compose(s.Args[0])
 	case OpDepend_:
 		for _, v := range s.Args[1:] {
 			_ = g.compose(v)
@@ -360,6 +442,33 @@ func (g *Graph) compose(s *Symbol) capi.SymbolHandle {
 	return op
 }
 
+/*
+Freeze sets frozen state of trainable params matching to the pattern
+and binds executor again when the set of trained params is changed
+*/
+func (g *Graph) Freeze(pattern func(string) bool, frozen bool) {
+	changed := false
+	for n := range g.Autograd {
+		if pattern(n) && g.Frozen[n] != frozen {
+			g.Frozen[n] = frozen
+			changed = true
+		}
+	}
+	if changed {
+		g.rebind()
+	}
+}
+
+func (g *Graph) rebind() {
+	capi.ReleaseExecutor(g.Exec)
+	g.Exec = nil
+	for _, v := range g.Grads {
+		v.Release()
+	}
+	g.Grads = make(map[string]*NDArray)
+	g.bind()
+}
+
 func (g *Graph) NextSymbolId() int {
 	g.symId++
 	return g.symId
@@ -367,7 +476,9 @@ func (g *Graph) NextSymbolId() int {
 
 func (g *Graph) InitParam(name string) {
 	param := g.Params[name]
-	if i, ok := g.Initializers[name]; ok && i != nil {
+	if d, ok := g.Initializers[name].(DerivedInite); ok {
+		d.Derive(param, g.Params)
+	} else if i, ok := g.Initializers[name]; ok && i != nil {
 		i.Inite(param)
 	} else {
 		if name[0] == '_' {
@@ -385,14 +496,20 @@ func (g *Graph) Initialize(seed int, inite func(*NDArray, string)) {
 	randomMu.Lock()
 	defer randomMu.Unlock()
 	g.Ctx.RandomSeed(seed)
+	derived := []string{}
 	for _, name := range keys {
 		if inite != nil {
 			param := g.Params[name]
 			inite(param, name)
+		} else if _, ok := g.Initializers[name].(DerivedInite); ok {
+			derived = append(derived, name)
 		} else {
 			g.InitParam(name)
 		}
 	}
+	for _, name := range derived {
+		g.InitParam(name)
+	}
 	g.Initialized = true
 }
 
@@ -401,6 +518,11 @@ func (g *Graph) Forward(train bool) {
 		panic("network is not intialized")
 	}
 	capi.Forward(g.Exec, train)
+	if train {
+		for n, o := range g.Assigns {
+			capi.ImperativeInvokeInOut1(capi.OpCopyTo, g.Outputs[o].handle, g.Params[n].handle)
+		}
+	}
 }
 
 func (g *Graph) Backward() {
@@ -29,3 +29,38 @@ func AdamUpdate(params, grads, mean, variance *NDArray, lr, beta1, beta2, epsilo
 		capi.KeyEpsilon, epsilon,
 		capi.KeyWd, wd)
 }
+
+func RmspropUpdate(params, grads, n *NDArray, lr, gamma1, epsilon, wd float64) {
+	capi.OptimizerUpdate(
+		capi.OpRmspropUpdate,
+		params.handle, grads.handle, n.handle, nil,
+		capi.KeyLr, lr,
+		capi.KeyGamma1, gamma1,
+		capi.KeyEpsilon, epsilon,
+		capi.KeyWd, wd)
+}
+
+/*
+RmspropAlexUpdate is the centered RMSProp update described by Alex Graves
+*/
+func RmspropAlexUpdate(params, grads, n, g, delta *NDArray, lr, gamma1, gamma2, epsilon, wd float64) {
+	capi.ImperativeInvokeInOutN(
+		capi.OpRmspropAlexUpdate,
+		params.handle,
+		[]capi.NDArrayHandle{params.handle, grads.handle, n.handle, g.handle, delta.handle},
+		capi.KeyLr, lr,
+		capi.KeyGamma1, gamma1,
+		capi.KeyGamma2, gamma2,
+		capi.KeyEpsilon, epsilon,
+		capi.KeyWd, wd)
+}
+
+func FtrlUpdate(params, grads, z, n *NDArray, lr, lamda1, beta, wd float64) {
+	capi.OptimizerUpdate(
+		capi.OpFtrlUpdate,
+		params.handle, grads.handle, z.handle, n.handle,
+		capi.KeyLr, lr,
+		capi.KeyLamda1, lamda1,
+		capi.KeyBeta, beta,
+		capi.KeyWd, wd)
+}
@@ -7,37 +7,63 @@ import (
 )
 
 const (
-	OpVar_    capi.MxnetOp = -1
-	OpInput_  capi.MxnetOp = -2
-	OpScalar_ capi.MxnetOp = -4
-	OpNogVar_ capi.MxnetOp = -5
-	OpGroup_  capi.MxnetOp = -7
-	OpRef_    capi.MxnetOp = -8
-	OpOutput_ capi.MxnetOp = -9
-	OpBound_  capi.MxnetOp = -10
-	OpDepend_ capi.MxnetOp = -11
-	OpLink_   capi.MxnetOp = -12
+	OpVar_     capi.MxnetOp = -1
+	OpInput_   capi.MxnetOp = -2
+	OpScalar_  capi.MxnetOp = -4
+	OpNogVar_  capi.MxnetOp = -5
+	OpGroup_   capi.MxnetOp = -7
+	OpRef_     capi.MxnetOp = -8
+	OpOutput_  capi.MxnetOp = -9
+	OpBound_   capi.MxnetOp = -10
+	OpDepend_  capi.MxnetOp = -11
+	OpLink_    capi.MxnetOp = -12
+	OpPenalty_ capi.MxnetOp = -13
+	OpAssign_  capi.MxnetOp = -14
 )
 
 type Inite interface {
 	Inite(*NDArray)
 }
 
+/*
+DerivedInite is an initializer calculating param from other params,
+graph initializes such params after all other params
+*/
+type DerivedInite interface {
+	Inite
+	Derive(a *NDArray, params map[string]*NDArray)
+}
+
+/*
+Constraint is applied to trained parameter after every optimizer update
+*/
+type Constraint interface {
+	Constrain(*NDArray)
+}
+
 type _Value struct{ Value []float32 }
 
 func (v *_Value) Inite(arr *NDArray) {
 	arr.SetValues(v.Value)
 }
 
+type _Ones struct{}
+
+func (_Ones) Inite(arr *NDArray) {
+	arr.Ones()
+}
+
 type Symbol struct {
-	Op     capi.MxnetOp             `yaml:"op"`
-	Value  string                   `yaml:"value"`
-	Name   string                   `yaml:"name"`
-	Args   []*Symbol                `yaml:"args"`
-	Init   Inite                    `yaml:"-"`
-	Attr   map[capi.MxnetKey]string `yaml:"attr"`
-	Dim    Dimension                `yaml:"dim"`
-	Output bool                     `yaml:"output"`
+	Op         capi.MxnetOp             `yaml:"op"`
+	Value      string                   `yaml:"value"`
+	Name       string                   `yaml:"name"`
+	Args       []*Symbol                `yaml:"args"`
+	Init       Inite                    `yaml:"-"`
+	Constraint Constraint               `yaml:"-"`
+	Attr       map[capi.MxnetKey]string `yaml:"attr"`
+	Dim        Dimension                `yaml:"dim"`
+	Output     bool                     `yaml:"output"`
+	Frozen     bool                     `yaml:"frozen"`
 }
 
 type _hidden_input_ struct{}
@@ -48,6 +74,11 @@ type _hidden_nograd_ struct{}
 
 func Nograd(_hidden_nograd_) {}
 
+type _hidden_frozen_ struct{}
+
+// Frozen marks variable to be trainable but initially frozen
+func Frozen(_hidden_frozen_) {}
+
 func (s *Symbol) SetName(name string) *Symbol {
 	s.Name = name
 	return s
@@ -70,6 +101,21 @@ func Depend(a ...*Symbol) *Symbol {
 	return &Symbol{Op: OpDepend_, Args: a}
 }
 
+/*
+Penalty attaches penalties to symbol, they are summed and added to the network loss
+*/
+func Penalty(a *Symbol, p ...*Symbol) *Symbol {
+	return &Symbol{Op: OpPenalty_, Args: append([]*Symbol{a}, p...)}
+}
+
+/*
+Assign returns symbol a and makes value to be copied into the non-gradient variable
+after every training forward pass, so variable keeps state between batches
+*/
+func Assign(a *Symbol, variable string, value *Symbol) *Symbol {
+	return &Symbol{Op: OpAssign_, Name: variable, Args: []*Symbol{a, value}}
+}
+
 func SymbolCast(i interface{}) (*Symbol, error) {
 	var o *Symbol
 	switch v := i.(type) {
@@ -220,6 +266,20 @@ func BcastSub(a, b *Symbol) *Symbol {
 	}
 }
 
+func BcastLike(a, b *Symbol) *Symbol {
+	return &Symbol{
+		Op:   capi.OpBroadcastLike,
+		Args: []*Symbol{a, b},
+	}
+}
+
+func BcastEqual(a, b *Symbol) *Symbol {
+	return &Symbol{
+		Op:   capi.OpBroadcastEqual,
+		Args: []*Symbol{a, b},
+	}
+}
+
 func Log(a *Symbol) *Symbol {
 	return &Symbol{Op: capi.OpLog, Args: []*Symbol{a}}
 }
@@ -243,8 +303,12 @@ func Var(name string, opt ...interface{}) *Symbol {
 			continue
 		} else if init, ok := t.(Inite); ok {
 			s.Init = init
+		} else if c, ok := t.(Constraint); ok {
+			s.Constraint = c
 		} else if _, ok := t.(func(_hidden_nograd_)); ok {
 			s.Op = OpNogVar_
+		} else if _, ok := t.(func(_hidden_frozen_)); ok {
+			s.Frozen = true
 		} else if dim, ok := t.(Dimension); ok {
 			s.Dim = dim
 		} else {
@@ -403,6 +467,17 @@ func Sum1(a *Symbol) *Symbol {
 	return s
 }
 
+func SumKd(a *Symbol, axis ...int) *Symbol {
+	s := &Symbol{Op: capi.OpSum, Args: []*Symbol{a},
+		Attr: map[capi.MxnetKey]string{
+			capi.KeyKeepdims: "1",
+		}}
+	if len(axis) > 0 {
+		s.Attr[capi.KeyAxis] = formatAxis(axis...)
+	}
+	return s
+}
+
 func SumXl(a *Symbol, axis ...int) *Symbol {
 	s := &Symbol{Op: capi.OpSum, Args: []*Symbol{a}}
 	if len(axis) > 0 {
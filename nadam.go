@@ -0,0 +1,85 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"math"
+)
+
+/*
+Nadam is Adam optimizer with Nesterov momentum
+*/
+type Nadam struct {
+	Lr, Beta1, Beta2, Epsilon, Decay, ScheduleDecay float64
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type stNadam struct {
+	Var       *mx.NDArray
+	Mean      *mx.NDArray
+	Index     int
+	MSchedule float64
+}
+
+type implNadam struct {
+	Nadam
+	scheduler
+	States map[*mx.NDArray]*stNadam
+}
+
+func (opt Nadam) Init(e int) Optimizer {
+	r := &implNadam{Nadam: opt, States: make(map[*mx.NDArray]*stNadam)}
+	if r.Beta1 == 0 {
+		r.Beta1 = 0.9
+	}
+	if r.Beta2 == 0 {
+		r.Beta2 = 0.999
+	}
+	if r.Epsilon == 0 {
+		r.Epsilon = 1e-8
+	}
+	if r.ScheduleDecay == 0 {
+		r.ScheduleDecay = 0.004
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.001, opt.Schedule)
+	return r
+}
+
+func (opt *implNadam) Release() {
+	for _, v := range opt.States {
+		v.Var.Release()
+		v.Mean.Release()
+	}
+}
+
+func (opt *implNadam) Update(params *mx.NDArray, grads *mx.NDArray) {
+	st, ok := opt.States[params]
+	if !ok {
+		st = &stNadam{Var: params.NewLikeThis().Zeros(), Mean: params.NewLikeThis().Zeros(), MSchedule: 1}
+		opt.States[params] = st
+	}
+	st.Index++
+	t := float64(st.Index)
+	mom := opt.Beta1 * (1 - 0.5*math.Pow(0.96, t*opt.ScheduleDecay))
+	momNext := opt.Beta1 * (1 - 0.5*math.Pow(0.96, (t+1)*opt.ScheduleDecay))
+	st.MSchedule *= mom
+	mScheduleNext := st.MSchedule * momNext
+
+	g := grads.Clone()
+	defer g.Release()
+	if opt.Decay != 0 {
+		g.AddScaled(params, float32(opt.Decay))
+	}
+	v := g.Clone()
+	defer v.Release()
+	st.Mean.Lerp(g, float32(1-opt.Beta1))
+	st.Var.Lerp(v.Square(), float32(1-opt.Beta2))
+
+	// m_bar = (1-mom)*g/(1-m_schedule) + mom_next*m/(1-m_schedule_next)
+	g.MulScalar(float32((1 - mom) / (1 - st.MSchedule)))
+	g.AddScaled(st.Mean, float32(momNext/(1-mScheduleNext)))
+	// params -= lr*m_bar/(sqrt(v/(1-beta2^t))+eps)
+	v.CopyFrom(st.Var).MulScalar(float32(1 / (1 - math.Pow(opt.Beta2, t)))).Sqrt().AddScalar(float32(opt.Epsilon))
+	params.AddScaled(g.Div(v), -float32(opt.lr))
+}
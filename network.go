@@ -1,9 +1,11 @@
 package nn
 
 import (
+	"context"
 	"go4ml.xyz/base/fu"
 	"go4ml.xyz/iokit"
 	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/zorros"
 	"time"
 )
 
@@ -12,31 +14,115 @@ type Network struct {
 	symbolic  *mx.Symbol
 	inputdim  mx.Dimension
 	BatchSize int
+	Steps     int // count of optimizer steps done
+
+	ClipValue      float32 // gradients are clipped to [-ClipValue,ClipValue] if it's specified
+	ClipGlobalNorm float32 // gradients are scaled to have global norm not greater than ClipGlobalNorm if it's specified
+	GradNorm       float32 // global norm of gradients on the last step before clipping
+
+	AccumulateSteps int // gradients are summed over AccumulateSteps batches before optimizer step
+	accumulated     int
+	accum           map[string]*mx.NDArray
+
+	rows      int     // count of real rows in the current batch, other rows are masked out
+	rowsScale float32 // multiplier of gradients of real rows in the current batch
+
+	opt   Optimizer       // optimizer of the training network, its state is written to checkpoints
+	mixed *mixedPrecision // master params of Float16 network
 }
 
 func (network *Network) Release() {
+	for _, a := range network.accum {
+		a.Release()
+	}
+	network.accum = nil
+	if network.mixed != nil {
+		network.mixed.Release()
+		network.mixed = nil
+	}
 	network.Graph.Release()
 }
 
 func New(context mx.Context, nn Block, inputdim mx.Dimension, loss mx.Loss, batchSize int, seed int) *Network {
+	return NewWithDtype(context, nn, inputdim, loss, batchSize, seed, mx.Float32)
+}
+
+/*
+NewWithDtype creates network having params and activations of specified dtype,
+Float16 network is trained with Float32 master params and dynamic loss scaling
+*/
+func NewWithDtype(context mx.Context, nn Block, inputdim mx.Dimension, loss mx.Loss, batchSize int, seed int, dtype mx.Dtype) *Network {
 	symbol := Combine(nn)
 	network := &Network{
-		Graph:     mx.Compose(context.Upgrade(), symbol, loss, inputdim.Push(batchSize), mx.Float32),
+		Graph:     mx.Compose(context.Upgrade(), symbol, loss, inputdim.Push(batchSize), dtype),
 		BatchSize: batchSize,
 		symbolic:  symbol,
 		inputdim:  inputdim,
 	}
 	network.Initialize(fu.Seed(seed), nil)
+	if dtype == mx.Float16 && loss != nil {
+		network.mixed = newMixedPrecision(network)
+	}
 	return network
 }
 
+/*
+LossScale returns the current loss scale of Float16 network or 1 for other networks
+*/
+func (network *Network) LossScale() float32 {
+	if network.mixed != nil {
+		return network.mixed.scale
+	}
+	return 1
+}
+
+/*
+param returns trained values of param, it's Float32 master copy for Float16 network
+*/
+func (network *Network) param(n string) *mx.NDArray {
+	if network.mixed != nil {
+		if a, ok := network.mixed.master[n]; ok {
+			return a
+		}
+	}
+	return network.Graph.Params[n]
+}
+
+/*
+copyParam copies array to param and to its master copy
+*/
+func (network *Network) copyParam(n string, a *mx.NDArray) {
+	network.Graph.Params[n].CopyFrom(a)
+	if network.mixed != nil {
+		if m, ok := network.mixed.master[n]; ok {
+			m.CopyFrom(a)
+		}
+	}
+}
+
+/*
+setParam sets values of param and of its master copy
+*/
+func (network *Network) setParam(n string, v interface{}) {
+	network.Graph.Params[n].SetValues(v)
+	if network.mixed != nil {
+		if a, ok := network.mixed.master[n]; ok {
+			a.SetValues(v)
+		}
+	}
+}
+
 func Load(context mx.Context, symbol, params iokit.Input, batchSize int) (*Network, error) {
 	sym, inputdim, err := LoadSymbol(symbol)
 	if err != nil {
 		return nil, err
 	}
+	dtype, err := paramsDtype(params)
+	if err != nil {
+		return nil, err
+	}
 	network := &Network{
-		Graph:     mx.Compose(context.Upgrade(), sym, nil, inputdim.Push(batchSize), mx.Float32),
+		Graph:     mx.Compose(context.Upgrade(), sym, nil, inputdim.Push(batchSize), dtype),
 		BatchSize: batchSize,
 		symbolic:  sym,
 		inputdim:  inputdim,
@@ -65,6 +151,22 @@ func Inherit(context mx.Context, nn Block, inputdim mx.Dimension, params iokit.I
 	return network, nil
 }
 
+/*
+LoadPretrained initializes network by params of model written by Memorize,
+params are loaded partially as LoadParamsPartial does
+*/
+func (network *Network) LoadPretrained(source iokit.Input, names map[string]string, collection ...string) (loaded []string, err error) {
+	m, err := Objectify(source, collection...)
+	if err != nil {
+		return
+	}
+	pm, ok := m.(PredictionModel)
+	if !ok {
+		return nil, zorros.Errorf("it's not neural network model")
+	}
+	return network.LoadParamsPartial(pm.params, names)
+}
+
 func (network *Network) Forward(data interface{}, out []float32) {
 	network.Graph.Input.SetValues(data)
 	network.Graph.Forward(false)
@@ -83,17 +185,323 @@ func (network *Network) Predict(data interface{}) [][]float32 {
 }
 
 func (network *Network) Train(data interface{}, label interface{}, opt Optimizer) {
+	network.setMask(network.BatchSize, 1)
 	network.Graph.Input.SetValues(data)
 	if network.Graph.Label != nil && label != nil {
 		network.Graph.Label.SetValues(label)
 	}
+	network.trainStep(opt)
+}
+
+/*
+TrainPartial trains network by batch having only length real rows and padding,
+padded rows are replaced by copies of real rows and masked out from gradients,
+gradients of real rows are scaled by BatchSize/length to be the same as for full batch.
+Copies of real rows are still counted by BatchNorm statistics of the batch
+*/
+func (network *Network) TrainPartial(data []float32, label []float32, length int, opt Optimizer) {
+	network.setBatch(data, label, length, true)
+	network.trainStep(opt)
+}
+
+/*
+setBatch sets network input and label by batch having length real rows,
+gradients of real rows are scaled to full batch if scaled is true
+*/
+func (network *Network) setBatch(data []float32, label []float32, length int, scaled bool) {
+	scale := float32(1)
+	if length > 0 && length < network.BatchSize {
+		if scaled {
+			scale = float32(network.BatchSize) / float32(length)
+		}
+		data = padRows(data, network.BatchSize, length)
+		if label != nil {
+			label = padRows(label, network.BatchSize, length)
+		}
+	} else {
+		length = network.BatchSize
+	}
+	network.setMask(length, scale)
+	network.Graph.Input.SetValues(data)
+	if network.Graph.Label != nil && label != nil {
+		network.Graph.Label.SetValues(label)
+	}
+}
+
+/*
+feedBatch sets network input and label by batch of feed,
+padded rows of grouped batch are kept as is because ranking loss excludes them
+*/
+func (network *Network) feedBatch(b *batch, scaled bool) {
+	length := b.length
+	if b.grouped {
+		length = network.BatchSize
+	}
+	network.setBatch(b.features, b.labels, length, scaled)
+}
+
+/*
+setMask masks out rows of batch starting from length and multiplies gradients of other rows by scale
+*/
+func (network *Network) setMask(length int, scale float32) {
+	if network.rows == 0 {
+		network.rows, network.rowsScale = network.BatchSize, 1
+	}
+	if network.Graph.Mask == nil || (network.rows == length && network.rowsScale == scale) {
+		return
+	}
+	m := make([]float32, network.BatchSize)
+	for i := 0; i < length; i++ {
+		m[i] = scale
+	}
+	network.Graph.Mask.SetValues(m)
+	network.rows, network.rowsScale = length, scale
+}
+
+/*
+padRows replaces padded rows by copies of length real rows
+*/
+func padRows(a []float32, batchSize, length int) []float32 {
+	w := len(a) / batchSize
+	r := make([]float32, len(a))
+	copy(r, a[:length*w])
+	for i := length; i < batchSize; i++ {
+		j := i % length
+		copy(r[i*w:(i+1)*w], a[j*w:(j+1)*w])
+	}
+	return r
+}
+
+func (network *Network) trainStep(opt Optimizer) {
 	network.Graph.Forward(true)
 	network.Graph.Backward()
+	if network.AccumulateSteps > 1 && !network.accumulate() {
+		return
+	}
+	network.Update(opt)
+}
+
+/*
+accumulate sums gradients into accumulation buffers and returns true
+when AccumulateSteps batches are summed and gradients are replaced by the sum
+*/
+func (network *Network) accumulate() bool {
+	if network.accum == nil {
+		network.accum = map[string]*mx.NDArray{}
+	}
+	first := network.accumulated == 0
+	for k, g := range network.Graph.Grads {
+		a, ok := network.accum[k]
+		if !ok {
+			a = g.NewLikeThis().Zeros()
+			network.accum[k] = a
+		}
+		if first {
+			a.CopyFrom(g)
+		} else {
+			a.Add(g)
+		}
+	}
+	if network.accumulated++; network.accumulated < network.AccumulateSteps {
+		return false
+	}
+	network.accumulated = 0
+	for k, g := range network.Graph.Grads {
+		g.CopyFrom(network.accum[k])
+	}
+	return true
+}
+
+/*
+flush makes optimizer step by gradients accumulated over the last batches of epoch
+when there are less than AccumulateSteps of them, it returns true if the step is done
+*/
+func (network *Network) flush(opt Optimizer) bool {
+	if network.accumulated == 0 {
+		return false
+	}
+	network.accumulated = 0
+	for k, g := range network.Graph.Grads {
+		if a, ok := network.accum[k]; ok {
+			g.CopyFrom(a)
+		} else {
+			g.Zeros()
+		}
+	}
 	network.Update(opt)
+	return true
 }
 
 func (network *Network) Update(opt Optimizer) {
+	if network.mixed != nil {
+		network.mixed.update(network, opt)
+		return
+	}
+	network.update(opt, network.Closure)
+}
+
+func (network *Network) update(opt Optimizer, closure func() float32) {
+	if co, ok := opt.(ClosureOptimizer); ok {
+		network.Minimize(co, closure)
+		return
+	}
+	network.step(opt)
+	network.UpdateParams(opt)
+}
+
+/*
+Minimize makes optimizer step with closure calculating loss and gradients for current params.
+Gradients of FullBatchOptimizer are calculated by closure, so they are not clipped
+and GradNorm is the norm of gradients calculated by the last closure call
+*/
+func (network *Network) Minimize(opt ClosureOptimizer, closure func() float32) {
+	network.step(opt)
+	opt.Minimize(network, closure)
+	if _, ok := opt.(FullBatchOptimizer); ok {
+		network.GradNorm = network.gradNorm()
+	}
+}
+
+func (network *Network) step(opt Optimizer) {
+	if _, ok := opt.(FullBatchOptimizer); !ok {
+		network.clipGrads()
+	}
+	if so, ok := opt.(ScheduledOptimizer); ok {
+		so.Step(network.Steps)
+	}
+	network.Steps++
+}
+
+/*
+constrain applies param constraints to all trained params
+*/
+func (network *Network) constrain() {
+	for k := range network.Graph.Grads {
+		if c, ok := network.Graph.Constraints[k]; ok {
+			c.Constrain(network.Graph.Params[k])
+		}
+	}
+}
+
+/*
+UpdateParams updates every trained param by optimizer and applies param constraints
+*/
+func (network *Network) UpdateParams(opt Optimizer) {
 	for k, g := range network.Graph.Grads {
-		opt.Update(network.Graph.Params[k], g)
+		p := network.Graph.Params[k]
+		if no, ok := opt.(NamedOptimizer); ok {
+			no.UpdateNamed(k, p, g)
+		} else {
+			opt.Update(p, g)
+		}
+		if c, ok := network.Graph.Constraints[k]; ok {
+			c.Constrain(p)
+		}
+	}
+}
+
+/*
+Closure calculates again loss and gradients of the last trained batch for the current params
+and returns the total loss including penalties of layers
+*/
+func (network *Network) Closure() float32 {
+	network.Graph.Forward(true)
+	network.Graph.Backward()
+	var r float32
+	loss := network.Graph.Loss.ValuesF32()
+	if len(loss) > 1 && network.rows > 0 {
+		loss = loss[:network.rows]
+	}
+	for _, v := range loss {
+		r += v
+	}
+	if p, ok := network.Graph.Outputs[mx.PenaltyName]; ok {
+		for _, v := range p.ValuesF32() {
+			r += v
+		}
+	}
+	return r
+}
+
+/*
+fullBatchClosure returns closure calculating loss and gradients over all training batches
+and function releasing closure buffers, the first error of feed is kept by err.
+When ctx is done, the pass is interrupted and closure returns loss of the last completed pass
+*/
+func (network *Network) fullBatchClosure(ctx context.Context, fd feed, err *error) (func() float32, func()) {
+	accum := map[string]*mx.NDArray{}
+	release := func() {
+		for _, a := range accum {
+			a.Release()
+		}
+	}
+	var last float32 // loss of the last completed pass
+	return func() float32 {
+		var loss float32
+		first := true
+		e := fd.train(func(b *batch) error {
+			if ctx.Err() != nil {
+				return errStopped
+			}
+			// gradients are summed over all rows like loss, so they are not scaled to full batch
+			network.feedBatch(b, false)
+			loss += network.Closure()
+			for k, g := range network.Graph.Grads {
+				a, ok := accum[k]
+				if !ok {
+					a = g.NewLikeThis()
+					accum[k] = a
+				}
+				if first {
+					a.CopyFrom(g)
+				} else {
+					a.Add(g)
+				}
+			}
+			first = false
+			return nil
+		})
+		if e == errStopped {
+			// optimizer gets the same loss for any params and can't make a step after training is interrupted
+			return last
+		}
+		if e != nil && *err == nil {
+			*err = e
+		}
+		for k, g := range network.Graph.Grads {
+			if a, ok := accum[k]; ok {
+				g.CopyFrom(a)
+			}
+		}
+		last = loss
+		return loss
+	}, release
+}
+
+/*
+Freeze freezes trainable params matching to any of patterns, frozen params have no gradients
+*/
+func (network *Network) Freeze(only ...string) {
+	if len(only) > 0 {
+		network.Graph.Freeze(patterns(only...), true)
+	}
+}
+
+/*
+Unfreeze makes trainable again frozen params matching to any of patterns
+*/
+func (network *Network) Unfreeze(only ...string) {
+	if len(only) > 0 {
+		network.Graph.Freeze(patterns(only...), false)
+	}
+}
+
+/*
+Trainable freezes all trainable params except matching to any of patterns
+*/
+func (network *Network) Trainable(only ...string) {
+	if len(only) > 0 {
+		patt := patterns(only...)
+		network.Graph.Freeze(func(n string) bool { return !patt(n) }, true)
 	}
 }
@@ -6,11 +6,131 @@ type OptimizerConf interface {
 	Init(epoch int) Optimizer
 }
 
+/*
+failingOptimizerConf is an optimizer configuration which can be not applicable,
+training reports such error instead of panic of Init
+*/
+type failingOptimizerConf interface {
+	initOptimizer(epoch int) (Optimizer, error)
+}
+
+/*
+NewOptimizer creates optimizer by configuration like Init does,
+but returns error if configuration is not applicable instead of panic
+*/
+func NewOptimizer(conf OptimizerConf, epoch int) (Optimizer, error) {
+	if fc, ok := conf.(failingOptimizerConf); ok {
+		return fc.initOptimizer(epoch)
+	}
+	return conf.Init(epoch), nil
+}
+
 type Optimizer interface {
 	Release()
 	Update(params *mx.NDArray, grads *mx.NDArray)
 }
 
+/*
+ScheduledOptimizer is an Optimizer having learning rate changed by epochs and steps,
+the network calls Step before every update with the count of steps done from the training start
+*/
+type ScheduledOptimizer interface {
+	Optimizer
+	Epoch(epoch int)
+	Step(step int)
+	CurrentLr() float64
+}
+
+/*
+scheduler keeps the current learning rate of optimizer
+*/
+type scheduler struct {
+	schedule    LrSchedule
+	lrmap       map[int]float64
+	fixed, dflt float64
+	base, lr    float64
+	mult        float64
+	set         float64 // learning rate set during training replacing the scheduled one
+}
+
+func newScheduler(epoch int, lr float64, lrmap map[int]float64, dflt float64, schedule LrSchedule) scheduler {
+	s := scheduler{schedule: schedule, lrmap: lrmap, fixed: lr, dflt: dflt, mult: 1}
+	s.Epoch(epoch)
+	return s
+}
+
+func (s *scheduler) Epoch(epoch int) {
+	s.base = s.fixed
+	if s.set > 0 {
+		s.base = s.set
+	} else if s.base == 0 {
+		s.base = locateLr(epoch, s.lrmap, s.dflt)
+	}
+	s.lr = s.base * s.mult
+}
+
+func (s *scheduler) Step(step int) {
+	if s.schedule != nil && s.set == 0 {
+		s.lr = s.schedule.Lr(step, s.base) * s.mult
+	}
+}
+
+// setLrMult sets multiplier of scheduled learning rate
+func (s *scheduler) setLrMult(mult float64) {
+	s.lr = s.lr / s.mult * mult
+	s.mult = mult
+}
+
+// setLr replaces scheduled learning rate, zero lr restores scheduling
+func (s *scheduler) setLr(lr float64) bool {
+	s.set = lr
+	if lr > 0 {
+		s.base = lr
+		s.lr = lr * s.mult
+	}
+	return true
+}
+
+func (s *scheduler) CurrentLr() float64 {
+	return s.lr
+}
+
+/*
+lrSetter is an optimizer which learning rate can be replaced during training
+*/
+type lrSetter interface {
+	setLr(lr float64) bool
+}
+
+/*
+NamedOptimizer is an Optimizer which needs param name to update it,
+the network calls UpdateNamed instead of Update when optimizer implements it
+*/
+type NamedOptimizer interface {
+	Optimizer
+	UpdateNamed(name string, params *mx.NDArray, grads *mx.NDArray)
+}
+
+/*
+ClosureOptimizer is an Optimizer making the whole step over all params at once,
+the network calls Minimize instead of updating params one by one.
+Closure calculates again loss and gradients of the current batch for the current params
+*/
+type ClosureOptimizer interface {
+	Optimizer
+	Minimize(network *Network, closure func() float32)
+}
+
+/*
+noDecay returns function matching names of params excluded from weight decay
+*/
+func noDecay(only []string) func(string) bool {
+	if len(only) == 0 {
+		return func(string) bool { return false }
+	}
+	return patterns(only...)
+}
+
 func locateLr(epoch int, lrmap map[int]float64, dflt float64) float64 {
 	lr := dflt
 	if lrmap != nil {
@@ -0,0 +1,234 @@
+package nn
+
+import (
+	"fmt"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/zorros"
+	"reflect"
+	"sort"
+)
+
+const stepsStateName = "_steps"
+
+// optimizerStatePrefix is the prefix of names of optimizer state which is not bound to params
+const optimizerStatePrefix = "_opt$"
+
+var ndarrayType = reflect.TypeOf((*mx.NDArray)(nil))
+
+/*
+delegatingOptimizer is an optimizer delegating update of named param to another optimizer
+*/
+type delegatingOptimizer interface {
+	optimizerOf(name string) Optimizer
+}
+
+/*
+statesOf returns States map of optimizer updating named param, optimizer keeps state of every param
+in the exported States map of arrays or structures with arrays and numbers
+*/
+func statesOf(opt Optimizer, name string) (reflect.Value, bool) {
+	for {
+		d, ok := opt.(delegatingOptimizer)
+		if !ok {
+			break
+		}
+		opt = d.optimizerOf(name)
+	}
+	v := reflect.ValueOf(opt)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	st := v.FieldByName("States")
+	if !st.IsValid() || st.Kind() != reflect.Map || st.Type().Key() != ndarrayType {
+		return reflect.Value{}, false
+	}
+	return st, true
+}
+
+/*
+stateFields calls f for every array or number of param state with the name of value
+*/
+func stateFields(n string, s reflect.Value, f func(string, reflect.Value)) {
+	if s.Kind() == reflect.Ptr && s.Type() != ndarrayType {
+		s = s.Elem()
+	}
+	if s.Kind() != reflect.Struct {
+		f(n+"$state", s)
+		return
+	}
+	for i := 0; i < s.NumField(); i++ {
+		if fd := s.Type().Field(i); fd.PkgPath == "" {
+			f(n+"$"+fd.Name, s.Field(i))
+		}
+	}
+}
+
+/*
+statefulOptimizer is an optimizer keeping state which is not bound to the States map of params,
+like slow weights of Lookahead or history of L-BFGS. Values of state are []float32 or []float64
+*/
+type statefulOptimizer interface {
+	saveState(network *Network, put func(name string, dim mx.Dimension, v interface{}))
+	loadState(network *Network, get func(name string) (mx.Dimension, interface{}, bool))
+}
+
+/*
+nestedOptimizer is an optimizer wrapping other optimizers
+*/
+type nestedOptimizer interface {
+	nested() []Optimizer
+}
+
+/*
+walkOptimizers calls f for optimizer and all optimizers nested into it
+with the prefix of state names unique for every optimizer
+*/
+func walkOptimizers(opt Optimizer, prefix string, f func(Optimizer, string)) {
+	f(opt, prefix)
+	if no, ok := opt.(nestedOptimizer); ok {
+		for i, o := range no.nested() {
+			walkOptimizers(o, fmt.Sprintf("%v%d$", prefix, i), f)
+		}
+	}
+}
+
+// firstValue returns the first of values read by ParamsReader.NextValues
+func firstValue(v interface{}) float64 {
+	if x, ok := v.([]float64); ok {
+		return x[0]
+	}
+	return float64(v.([]float32)[0])
+}
+
+/*
+SaveOptimizerState writes state of optimizer params, state of optimizer itself
+and count of done steps in the params file format, Float64 arrays and numbers are written as Float64
+*/
+func (network *Network) SaveOptimizerState(opt Optimizer, output iokit.Output) (err error) {
+	dims := map[string]mx.Dimension{stepsStateName: mx.Dim(1)}
+	values := map[string]interface{}{stepsStateName: []float64{float64(network.Steps)}}
+	for n := range network.Params {
+		p := network.param(n)
+		st, ok := statesOf(opt, n)
+		if !ok {
+			continue
+		}
+		s := st.MapIndex(reflect.ValueOf(p))
+		if !s.IsValid() {
+			continue
+		}
+		stateFields(n, s, func(name string, f reflect.Value) {
+			switch {
+			case f.Type() == ndarrayType:
+				if !f.IsNil() {
+					dims[name], values[name] = arrayValue(f.Interface().(*mx.NDArray))
+				}
+			case f.Kind() >= reflect.Int && f.Kind() <= reflect.Int64:
+				dims[name], values[name] = mx.Dim(1), []float64{float64(f.Int())}
+			case f.Kind() == reflect.Float32 || f.Kind() == reflect.Float64:
+				dims[name], values[name] = mx.Dim(1), []float64{f.Float()}
+			}
+		})
+	}
+	walkOptimizers(opt, optimizerStatePrefix, func(o Optimizer, prefix string) {
+		if so, ok := o.(statefulOptimizer); ok {
+			so.saveState(network, func(name string, dim mx.Dimension, v interface{}) {
+				dims[prefix+name], values[prefix+name] = dim, v
+			})
+		}
+	})
+	names := make([]string, 0, len(values))
+	for n := range values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return writeParams(output, names,
+		func(n string) mx.Dtype {
+			if _, ok := values[n].([]float64); ok {
+				return mx.Float64
+			}
+			return mx.Float32
+		},
+		func(n string) (mx.Dimension, interface{}) { return dims[n], values[n] })
+}
+
+/*
+LoadOptimizerState restores state of optimizer and count of done steps written by SaveOptimizerState
+*/
+func (network *Network) LoadOptimizerState(opt Optimizer, input iokit.Input) (err error) {
+	var r *ParamsReader
+	if r, err = NewParamsReader(input); err != nil {
+		return zorros.Trace(err)
+	}
+	defer r.Close()
+	dims := map[string]mx.Dimension{}
+	values := map[string]interface{}{}
+	for r.HasMore() {
+		n, dim, _, v, err := r.NextValues()
+		if err != nil {
+			return zorros.Trace(err)
+		}
+		dims[n], values[n] = dim, v
+	}
+	if v, ok := values[stepsStateName]; ok {
+		network.Steps = int(firstValue(v))
+	}
+
+	for n := range network.Params {
+		p := network.param(n)
+		st, ok := statesOf(opt, n)
+		if !ok {
+			continue
+		}
+		vt := st.Type().Elem()
+		key := reflect.ValueOf(p)
+		cur := st.MapIndex(key)
+		var x reflect.Value
+		if vt.Kind() == reflect.Ptr && vt != ndarrayType {
+			if x = cur; !x.IsValid() {
+				x = reflect.New(vt.Elem())
+			}
+		} else if x = reflect.New(vt).Elem(); cur.IsValid() {
+			x.Set(cur)
+		}
+		loaded := false
+		stateFields(n, x, func(name string, f reflect.Value) {
+			v, ok := values[name]
+			if !ok {
+				return
+			}
+			switch {
+			case f.Type() == ndarrayType:
+				if f.IsNil() {
+					f.Set(reflect.ValueOf(p.Context().Array(p.Dtype(), dims[name])))
+				} else if f.Interface().(*mx.NDArray).Dim() != dims[name] {
+					return
+				}
+				f.Interface().(*mx.NDArray).SetValues(v)
+			case f.Kind() >= reflect.Int && f.Kind() <= reflect.Int64:
+				f.SetInt(int64(firstValue(v)))
+			case f.Kind() == reflect.Float32 || f.Kind() == reflect.Float64:
+				f.SetFloat(firstValue(v))
+			default:
+				return
+			}
+			loaded = true
+		})
+		if loaded {
+			st.SetMapIndex(key, x)
+		}
+	}
+	walkOptimizers(opt, optimizerStatePrefix, func(o Optimizer, prefix string) {
+		if so, ok := o.(statefulOptimizer); ok {
+			so.loadState(network, func(name string) (mx.Dimension, interface{}, bool) {
+				v, ok := values[prefix+name]
+				return dims[prefix+name], v, ok
+			})
+		}
+	})
+	return
+}
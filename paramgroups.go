@@ -0,0 +1,174 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/zorros"
+	"reflect"
+)
+
+/*
+ParamGroup defines optimizer settings for params matched to any of Patterns,
+patterns are matched like in Network.SaveParams
+*/
+type ParamGroup struct {
+	Patterns  []string
+	LrMult    float64       // multiplier of learning rate, 1 by default
+	Decay     float64       // weight decay replacing decay of optimizer if specified
+	NoDecay   bool          // params are not decayed
+	Optimizer OptimizerConf // optimizer of group params, the common optimizer is used if it's not specified
+}
+
+/*
+ParamGroups is an optimizer applying settings of the first matched group to every param,
+params not matched to any group are updated by Optimizer as is
+*/
+type ParamGroups struct {
+	Optimizer OptimizerConf
+	Groups    []ParamGroup
+}
+
+type implParamGroups struct {
+	patts []func(string) bool
+	opts  []Optimizer // one optimizer per group and the last one is the common optimizer
+}
+
+/*
+setDecay changes Decay field of optimizer, it's set after optimizer initialization
+so the zero decay is not replaced by the optimizer default
+*/
+func setDecay(opt Optimizer, decay float64) error {
+	v := reflect.ValueOf(opt)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if d := v.FieldByName("Decay"); d.Kind() == reflect.Float64 && d.CanSet() {
+			d.SetFloat(decay)
+			return nil
+		}
+	}
+	return zorros.Errorf("optimizer %T does not support weight decay", opt)
+}
+
+/*
+Init creates optimizer of groups, it panics if group settings are not supported by optimizer,
+NewOptimizer and training return such error instead
+*/
+func (pg ParamGroups) Init(e int) Optimizer {
+	opt, err := pg.initOptimizer(e)
+	if err != nil {
+		panic(err.Error())
+	}
+	return opt
+}
+
+func (pg ParamGroups) initOptimizer(e int) (_ Optimizer, err error) {
+	r := &implParamGroups{}
+	defer func() {
+		if err != nil {
+			r.Release()
+		}
+	}()
+	for _, g := range pg.Groups {
+		conf := g.Optimizer
+		if conf == nil {
+			conf = pg.Optimizer
+		}
+		var opt Optimizer
+		if opt, err = NewOptimizer(conf, e); err != nil {
+			return
+		}
+		r.opts = append(r.opts, opt)
+		r.patts = append(r.patts, patterns(g.Patterns...))
+		if g.NoDecay {
+			err = setDecay(opt, 0)
+		} else if g.Decay != 0 {
+			err = setDecay(opt, g.Decay)
+		}
+		if err != nil {
+			return
+		}
+		if g.LrMult != 0 {
+			if m, ok := opt.(interface{ setLrMult(float64) }); ok {
+				m.setLrMult(g.LrMult)
+			} else {
+				return nil, zorros.Errorf("optimizer %T does not support learning rate multiplier", opt)
+			}
+		}
+	}
+	opt, err := NewOptimizer(pg.Optimizer, e)
+	if err != nil {
+		return
+	}
+	r.opts = append(r.opts, opt)
+	return r, nil
+}
+
+func (opt *implParamGroups) optimizerOf(name string) Optimizer {
+	for i, p := range opt.patts {
+		if p(name) {
+			return opt.opts[i]
+		}
+	}
+	return opt.opts[len(opt.patts)]
+}
+
+func (opt *implParamGroups) nested() []Optimizer {
+	return opt.opts
+}
+
+func (opt *implParamGroups) Release() {
+	for _, o := range opt.opts {
+		o.Release()
+	}
+}
+
+func (opt *implParamGroups) Update(params *mx.NDArray, grads *mx.NDArray) {
+	opt.opts[len(opt.patts)].Update(params, grads)
+}
+
+func (opt *implParamGroups) UpdateNamed(name string, params *mx.NDArray, grads *mx.NDArray) {
+	o := opt.optimizerOf(name)
+	if no, ok := o.(NamedOptimizer); ok {
+		no.UpdateNamed(name, params, grads)
+	} else {
+		o.Update(params, grads)
+	}
+}
+
+func (opt *implParamGroups) Epoch(epoch int) {
+	for _, o := range opt.opts {
+		if so, ok := o.(ScheduledOptimizer); ok {
+			so.Epoch(epoch)
+		}
+	}
+}
+
+func (opt *implParamGroups) Step(step int) {
+	for _, o := range opt.opts {
+		if so, ok := o.(ScheduledOptimizer); ok {
+			so.Step(step)
+		}
+	}
+}
+
+// setLr changes learning rate of all group optimizers supporting it and returns true if all of them support it
+func (opt *implParamGroups) setLr(lr float64) bool {
+	all := true
+	for _, o := range opt.opts {
+		if ls, ok := o.(lrSetter); !ok || !ls.setLr(lr) {
+			all = false
+		}
+	}
+	return all
+}
+
+/*
+CurrentLr returns learning rate of the common optimizer
+*/
+func (opt *implParamGroups) CurrentLr() float64 {
+	if so, ok := opt.opts[len(opt.patts)].(ScheduledOptimizer); ok {
+		return so.CurrentLr()
+	}
+	return 0
+}
@@ -10,6 +10,8 @@ import (
 	"golang.org/x/xerrors"
 	"io"
 	"math"
+	"sort"
+	"strings"
 )
 
 func nf(p func(string) bool, f func(string) bool) func(string) bool {
@@ -21,7 +23,10 @@ func nf(p func(string) bool, f func(string) bool) func(string) bool {
 	}
 }
 
-func (network *Network) SaveParams(output iokit.Output, only ...string) (err error) {
+/*
+patterns returns function matching name to any of patterns or any name if there are no patterns
+*/
+func patterns(only ...string) func(string) bool {
 	patt := func(string) bool { return true }
 	if len(only) > 0 {
 		patt = func(string) bool { return false }
@@ -29,26 +34,59 @@ func (network *Network) SaveParams(output iokit.Output, only ...string) (err err
 			patt = nf(fu.Pattern(o), patt)
 		}
 	}
+	return patt
+}
+
+func (network *Network) SaveParams(output iokit.Output, only ...string) (err error) {
+	patt := patterns(only...)
+	params := []string{}
+	for _, n := range fu.SortedKeysOf(network.Params).([]string) {
+		if n[0] != '_' && patt(n) {
+			params = append(params, n)
+		}
+	}
+	// Float16 network writes master params of trained layers as Float32 and other params as Float16
+	return writeParams(output, params,
+		func(n string) mx.Dtype {
+			if dt := network.param(n).Dtype(); dt == mx.Float64 || dt == mx.Float16 {
+				return dt
+			}
+			return mx.Float32
+		},
+		func(n string) (mx.Dimension, interface{}) {
+			d := network.param(n)
+			if d.Dtype() == mx.Float64 {
+				return d.Dim(), d.Values(mx.Float64)
+			}
+			return d.Dim(), d.ValuesF32()
+		})
+}
+
+/*
+writeParams writes named values in the params file format,
+values are []float64 for Float64 params and []float32 for others including Float16.
+The file is ANN1 without dtypes when all params are Float32 and ANN2 having dtype of every param otherwise
+*/
+func writeParams(output iokit.Output, params []string, dtype func(string) mx.Dtype, value func(string) (mx.Dimension, interface{})) (err error) {
 	var wr iokit.Whole
 	if wr, err = output.Create(); err != nil {
 		return zorros.Trace(err)
 	}
 	defer wr.End()
-	params := fu.SortedKeysOf(network.Params).([]string)
 	b := []byte{0, 0, 0, 0}
 	dil := []byte{0xa, '-', '-', 0xa}
 	magic := []byte{'A', 'N', 'N', '1'}
+	for _, n := range params {
+		if dtype(n) != mx.Float32 {
+			magic[3] = '2'
+			break
+		}
+	}
 	order := binary.ByteOrder(binary.LittleEndian)
 	if _, err = wr.Write(magic); err != nil {
 		return zorros.Trace(err)
 	}
-	count := 0
-	for _, n := range params {
-		if n[0] != '_' && patt(n) {
-			count++
-		}
-	}
-	order.PutUint32(b, uint32(count))
+	order.PutUint32(b, uint32(len(params)))
 	if _, err = wr.Write(b); err != nil {
 		return zorros.Trace(err)
 	}
@@ -56,17 +94,20 @@ func (network *Network) SaveParams(output iokit.Output, only ...string) (err err
 		return zorros.Trace(err)
 	}
 	for _, n := range params {
-		if n[0] == '_' || !patt(n) {
-			continue
-		}
-		d := network.Params[n]
+		dt := dtype(n)
+		dim, v := value(n)
 		if err = binary.Write(wr, order, int32(len(n))); err != nil {
 			return zorros.Trace(err)
 		}
 		if err = binary.Write(wr, order, []byte(n)); err != nil {
 			return zorros.Trace(err)
 		}
-		dim := d.Dim()
+		if magic[3] == '2' {
+			order.PutUint32(b, uint32(dt))
+			if _, err = wr.Write(b); err != nil {
+				return zorros.Trace(err)
+			}
+		}
 		order.PutUint32(b, uint32(dim.Len))
 		if _, err = wr.Write(b); err != nil {
 			return zorros.Trace(err)
@@ -77,17 +118,20 @@ func (network *Network) SaveParams(output iokit.Output, only ...string) (err err
 				return zorros.Trace(err)
 			}
 		}
-		total := dim.Total()
-		order.PutUint32(b, uint32(total))
+		order.PutUint32(b, uint32(dim.Total()))
 		if _, err = wr.Write(b); err != nil {
 			return zorros.Trace(err)
 		}
-		v := d.ValuesF32()
-		for i := 0; i < total; i++ {
-			order.PutUint32(b, math.Float32bits(v[i]))
-			if _, err = wr.Write(b); err != nil {
-				return zorros.Trace(err)
+		if dt == mx.Float16 {
+			f := v.([]float32)
+			h := make([]uint16, len(f))
+			for i, x := range f {
+				h[i] = float16bits(x)
 			}
+			v = h
+		}
+		if err = binary.Write(wr, order, v); err != nil {
+			return zorros.Trace(err)
 		}
 		if _, err = wr.Write(dil); err != nil {
 			return zorros.Trace(err)
@@ -96,12 +140,71 @@ func (network *Network) SaveParams(output iokit.Output, only ...string) (err err
 	return wr.Commit()
 }
 
+/*
+float16bits converts float32 value to IEEE 754 half precision bits rounding to nearest
+*/
+func float16bits(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case int(b>>23&0xff) == 0xff:
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h := uint16(mant >> shift)
+		if mant>>(shift-1)&1 != 0 {
+			h++
+		}
+		return sign | h
+	}
+	h := sign | uint16(exp)<<10 | uint16(mant>>13)
+	if mant&0x1000 != 0 {
+		h++
+	}
+	return h
+}
+
+/*
+float16frombits converts IEEE 754 half precision bits to float32 value
+*/
+func float16frombits(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			return -f
+		}
+		return f
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
 var prdDIL = []byte{0xa, '-', '-', 0xa}
 
 type ParamsReader struct {
 	io.Closer
-	r     io.Reader
-	least int
+	r       io.Reader
+	least   int
+	version int
 }
 
 func NewParamsReader(input iokit.Input) (prd *ParamsReader, err error) {
@@ -123,7 +226,10 @@ func NewParamsReader(input iokit.Input) (prd *ParamsReader, err error) {
 	if _, err = io.ReadFull(r, b); err != nil {
 		return nil, zorros.Trace(err)
 	}
-	if !equal4b(magic) {
+	version := 1
+	if magic[3] = '2'; equal4b(magic) {
+		version = 2
+	} else if magic[3] = '1'; !equal4b(magic) {
 		return nil, xerrors.Errorf("bad magic")
 	}
 	if _, err = io.ReadFull(r, b); err != nil {
@@ -137,7 +243,7 @@ func NewParamsReader(input iokit.Input) (prd *ParamsReader, err error) {
 		return nil, xerrors.Errorf("bad delimiter")
 	}
 
-	prd = &ParamsReader{rd.(io.Closer), r, count}
+	prd = &ParamsReader{rd.(io.Closer), r, count, version}
 	return prd, nil
 }
 
@@ -146,6 +252,33 @@ func (prd *ParamsReader) HasMore() bool {
 }
 
 func (prd *ParamsReader) Next() (n string, out []float32, err error) {
+	n, _, out, err = prd.NextWithDim()
+	return
+}
+
+/*
+NextWithDim reads next param returning it's dimension with values
+*/
+func (prd *ParamsReader) NextWithDim() (n string, dim mx.Dimension, out []float32, err error) {
+	var v interface{}
+	if n, dim, _, v, err = prd.NextValues(); err != nil {
+		return
+	}
+	if x, ok := v.([]float64); ok {
+		out = make([]float32, len(x))
+		for i, f := range x {
+			out[i] = float32(f)
+		}
+		return
+	}
+	return n, dim, v.([]float32), nil
+}
+
+/*
+NextValues reads next param returning it's dimension, dtype recorded in params file and values,
+values are []float64 for Float64 params and []float32 for others
+*/
+func (prd *ParamsReader) NextValues() (n string, dim mx.Dimension, dtype mx.Dtype, v interface{}, err error) {
 	b := []byte{0, 0, 0, 0}
 	equal4b := func(a []byte) bool { return a[0] == b[0] && a[1] == b[1] && a[2] == b[2] && a[3] == b[3] }
 	order := binary.ByteOrder(binary.LittleEndian)
@@ -160,7 +293,18 @@ func (prd *ParamsReader) Next() (n string, out []float32, err error) {
 		return
 	}
 	n = string(ns)
-	dim := mx.Dimension{}
+	dtype = mx.Float32
+	if prd.version > 1 {
+		if _, err = io.ReadFull(prd.r, b); err != nil {
+			err = zorros.Trace(err)
+			return
+		}
+		dtype = mx.Dtype(order.Uint32(b))
+		if dtype != mx.Float32 && dtype != mx.Float64 && dtype != mx.Float16 {
+			err = xerrors.Errorf("unsupported dtype of '%v' layer params", n)
+			return
+		}
+	}
 	if _, err = io.ReadFull(prd.r, b); err != nil {
 		err = zorros.Trace(err)
 		return
@@ -186,13 +330,27 @@ func (prd *ParamsReader) Next() (n string, out []float32, err error) {
 		err = xerrors.Errorf("bad dimension of '%v' layer params or values total count is incorrect", n)
 		return
 	}
-	v := make([]float32, total)
-	for i := range v {
-		if _, err = io.ReadFull(prd.r, b); err != nil {
-			err = zorros.Trace(err)
-			return
+	switch dtype {
+	case mx.Float64:
+		x := make([]float64, total)
+		err = binary.Read(prd.r, order, x)
+		v = x
+	case mx.Float16:
+		h := make([]uint16, total)
+		err = binary.Read(prd.r, order, h)
+		x := make([]float32, total)
+		for i, q := range h {
+			x[i] = float16frombits(q)
 		}
-		v[i] = math.Float32frombits(order.Uint32(b))
+		v = x
+	default:
+		x := make([]float32, total)
+		err = binary.Read(prd.r, order, x)
+		v = x
+	}
+	if err != nil {
+		err = zorros.Trace(err)
+		return
 	}
 	if _, err = io.ReadFull(prd.r, b); err != nil {
 		err = zorros.Trace(err)
@@ -203,7 +361,30 @@ func (prd *ParamsReader) Next() (n string, out []float32, err error) {
 		return
 	}
 	prd.least--
-	return n, v, nil
+	return
+}
+
+/*
+paramsDtype returns dtype network should have to keep params without precision loss,
+it's Float64 if any param is Float64 and Float32 otherwise because Float32 keeps Float16 params too
+*/
+func paramsDtype(input iokit.Input) (dtype mx.Dtype, err error) {
+	var r *ParamsReader
+	if r, err = NewParamsReader(input); err != nil {
+		return
+	}
+	defer r.Close()
+	dtype = mx.Float32
+	for r.HasMore() {
+		var dt mx.Dtype
+		if _, _, dt, _, err = r.NextValues(); err != nil {
+			return
+		}
+		if dt == mx.Float64 {
+			return mx.Float64, nil
+		}
+	}
+	return
 }
 
 func (network *Network) LoadParams(input iokit.Input, forced ...bool) (err error) {
@@ -216,15 +397,15 @@ func (network *Network) LoadParams(input iokit.Input, forced ...bool) (err error
 	ready := map[string]bool{}
 
 	for r.HasMore() {
-		n, v, err := r.Next()
+		n, dim, _, v, err := r.NextValues()
 		if err != nil {
 			return zorros.Trace(err)
 		}
 		if d, ok := network.Params[n]; ok {
-			if d.Dim().Total() != len(v) {
+			if d.Dim().Total() != dim.Total() {
 				return xerrors.Errorf("bad deimension of '%v' layer params or values total count is incorrect", n)
 			}
-			d.SetValues(v)
+			network.setParam(n, v)
 			ready[n] = true
 		}
 	}
@@ -240,3 +421,56 @@ func (network *Network) LoadParams(input iokit.Input, forced ...bool) (err error
 	network.Initialized = true
 	return nil
 }
+
+/*
+rename returns param name with replaced name or prefix of layer from names map,
+the longest matched key is used, the empty string means param is skipped
+*/
+func rename(n string, names map[string]string) string {
+	if r, ok := names[n]; ok {
+		return r
+	}
+	k := ""
+	for x := range names {
+		if len(x) > len(k) && len(n) > len(x) && strings.HasPrefix(n, x) && (n[len(x)] == '_' || n[len(x)] == '$') {
+			k = x
+		}
+	}
+	if k == "" {
+		return n
+	}
+	if names[k] == "" {
+		return ""
+	}
+	return names[k] + n[len(k):]
+}
+
+/*
+LoadParamsPartial loads params having the same name and shape as network params,
+other params keep their values. Names of loaded params can be remapped by names map
+where key is a param or layer name and value is a new name
+*/
+func (network *Network) LoadParamsPartial(input iokit.Input, names map[string]string) (loaded []string, err error) {
+	var r *ParamsReader
+	if r, err = NewParamsReader(input); err != nil {
+		return nil, zorros.Trace(err)
+	}
+	defer r.Close()
+
+	for r.HasMore() {
+		n, dim, _, v, err := r.NextValues()
+		if err != nil {
+			return nil, zorros.Trace(err)
+		}
+		if n = rename(n, names); n == "" {
+			continue
+		}
+		if d, ok := network.Params[n]; ok && d.Dim() == dim {
+			network.setParam(n, v)
+			loaded = append(loaded, n)
+		}
+	}
+
+	sort.Strings(loaded)
+	return
+}
@@ -0,0 +1,137 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"math"
+)
+
+/*
+DP is differentially private training (DP-SGD). The gradient of every example is clipped
+to have L2 norm not greater than Clip, clipped gradients are summed, Gaussian noise
+with standard deviation Noise*Clip is added and the sum is divided by batch size.
+Epsilon of (epsilon,Delta)-privacy is calculated by RDP accountant and reported by Epsilon metric.
+Clip and Noise are 1 and Delta is 1e-5 by default.
+Per-example gradients are calculated by the network with batch size 1, so BatchNorm layers are not supported
+*/
+type DP struct {
+	Clip, Noise, Delta float64
+}
+
+type privateTrainer struct {
+	DP
+	single      *Network
+	sum         map[string]*mx.NDArray
+	rows, steps int
+	loss        float32 // mean loss of the last trained batch
+}
+
+func newPrivateTrainer(dp DP, e Model) *privateTrainer {
+	dp.Clip = fnzf(dp.Clip, 1)
+	dp.Noise = fnzf(dp.Noise, 1)
+	dp.Delta = fnzf(dp.Delta, 1e-5)
+	return &privateTrainer{
+		DP:     dp,
+		single: NewWithDtype(e.Context.Upgrade(), e.Network, e.Input, e.Loss, 1, e.Seed, e.Dtype),
+		sum:    map[string]*mx.NDArray{},
+	}
+}
+
+func (pt *privateTrainer) Release() {
+	for _, s := range pt.sum {
+		s.Release()
+	}
+	pt.single.Release()
+}
+
+/*
+train makes DP-SGD step of network on the batch
+*/
+func (pt *privateTrainer) train(network *Network, b *batch, opt Optimizer) {
+	for n, p := range network.Params {
+		if q, ok := pt.single.Params[n]; ok && n[0] != '_' {
+			q.CopyFrom(p)
+		}
+	}
+	for n, g := range network.Graph.Grads {
+		if _, ok := pt.sum[n]; !ok {
+			pt.sum[n] = g.NewLikeThis()
+		}
+		pt.sum[n].Zeros()
+	}
+	fw := len(b.features) / network.BatchSize
+	lw := len(b.labels) / network.BatchSize
+	pt.loss = 0
+	for i := 0; i < b.length; i++ {
+		pt.single.Graph.Input.SetValues(b.features[i*fw : (i+1)*fw])
+		if pt.single.Graph.Label != nil {
+			pt.single.Graph.Label.SetValues(b.labels[i*lw : (i+1)*lw])
+		}
+		pt.single.Graph.Forward(true)
+		pt.single.Graph.Backward()
+		for _, v := range pt.single.Graph.Loss.ValuesF32() {
+			pt.loss += v / float32(b.length)
+		}
+		sq := 0.
+		for n := range network.Graph.Grads {
+			v := float64(pt.single.Graph.Grads[n].Norm())
+			sq += v * v
+		}
+		k := float32(math.Min(1, pt.Clip/(math.Sqrt(sq)+1e-12)))
+		for n, s := range pt.sum {
+			if _, ok := network.Graph.Grads[n]; ok {
+				s.AddScaled(pt.single.Graph.Grads[n], k)
+			}
+		}
+	}
+	for n, g := range network.Graph.Grads {
+		s := pt.sum[n]
+		noise := s.NewLikeThis().Normal(0, float32(pt.Noise*pt.Clip))
+		s.Add(noise).MulScalar(1 / float32(network.BatchSize))
+		noise.Release()
+		g.CopyFrom(s)
+	}
+	network.Update(opt)
+	pt.steps++
+	pt.rows += b.length
+}
+
+/*
+epsilon returns epsilon of privacy spent by all steps done,
+rows is count of training rows in one epoch
+*/
+func (pt *privateTrainer) epsilon(batchSize, rows int) float64 {
+	q := math.Min(1, float64(batchSize)/float64(rows))
+	return DPEpsilon(q, pt.Noise, pt.steps, pt.Delta)
+}
+
+/*
+DPEpsilon calculates epsilon of (epsilon,delta)-privacy of steps of sampled Gaussian mechanism
+with sampling rate q and noise multiplier sigma by Renyi differential privacy accountant
+*/
+func DPEpsilon(q, sigma float64, steps int, delta float64) float64 {
+	eps := math.Inf(1)
+	for a := 2; a <= 256; a++ {
+		r := float64(steps)*rdpSampledGaussian(q, sigma, a) + math.Log(1/delta)/float64(a-1)
+		eps = math.Min(eps, r)
+	}
+	return eps
+}
+
+/*
+rdpSampledGaussian returns RDP of integer order a of one step of sampled Gaussian mechanism
+*/
+func rdpSampledGaussian(q, sigma float64, a int) float64 {
+	if q >= 1 {
+		return float64(a) / (2 * sigma * sigma)
+	}
+	logA := math.Inf(-1)
+	lg1, _ := math.Lgamma(float64(a + 1))
+	for k := 0; k <= a; k++ {
+		lg2, _ := math.Lgamma(float64(k + 1))
+		lg3, _ := math.Lgamma(float64(a - k + 1))
+		t := lg1 - lg2 - lg3 + float64(a-k)*math.Log1p(-q) + float64(k)*math.Log(q) + float64(k*k-k)/(2*sigma*sigma)
+		m := math.Max(logA, t)
+		logA = m + math.Log(math.Exp(logA-m)+math.Exp(t-m))
+	}
+	return logA / float64(a-1)
+}
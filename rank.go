@@ -0,0 +1,214 @@
+package nn
+
+import (
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/base/model"
+	"go4ml.xyz/zorros"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// default k for NDCG@k metric
+const DefaultNdcgAt = 10
+
+/*
+Ndcg calculates NDCG@k of one group of rows
+ordered by score and having given relevance
+*/
+func Ndcg(k int, score, relevance []float32) float64 {
+	dcg := func(idx []int) (r float64) {
+		for i, j := range idx {
+			if i >= k {
+				break
+			}
+			r += (math.Pow(2, float64(relevance[j])) - 1) / math.Log2(float64(i)+2)
+		}
+		return
+	}
+	byScore := make([]int, len(score))
+	byRelevance := make([]int, len(score))
+	for i := range score {
+		byScore[i] = i
+		byRelevance[i] = i
+	}
+	sort.SliceStable(byScore, func(i, j int) bool { return score[byScore[i]] > score[byScore[j]] })
+	sort.SliceStable(byRelevance, func(i, j int) bool { return relevance[byRelevance[i]] > relevance[byRelevance[j]] })
+	ideal := dcg(byRelevance)
+	if ideal == 0 {
+		return 1
+	}
+	return dcg(byScore) / ideal
+}
+
+/*
+ndcgMetric accumulates NDCG@k over groups of evaluated batches
+*/
+type ndcgMetric struct {
+	k                     int
+	train, test           float64
+	trainCount, testCount int
+}
+
+func (nm *ndcgMetric) update(out []float32, b *batch, batchSize int) {
+	stride := len(out) / batchSize
+	score := map[int][]float32{}
+	relevance := map[int][]float32{}
+	test := map[int]bool{}
+	for i := 0; i < b.length; i++ {
+		g := int(b.labels[i*2+1])
+		score[g] = append(score[g], out[i*stride])
+		relevance[g] = append(relevance[g], b.labels[i*2])
+		test[g] = b.test(i)
+	}
+	for g, s := range score {
+		v := Ndcg(nm.k, s, relevance[g])
+		if test[g] {
+			nm.test += v
+			nm.testCount++
+		} else {
+			nm.train += v
+			nm.trainCount++
+		}
+	}
+}
+
+func (nm *ndcgMetric) complete(train, test fu.Struct) (fu.Struct, fu.Struct) {
+	mean := func(v float64, n int) float64 {
+		if n == 0 {
+			return 0
+		}
+		return v / float64(n)
+	}
+	train = withMetric(train, "Ndcg", mean(nm.train, nm.trainCount))
+	test = withMetric(test, "Ndcg", mean(nm.test, nm.testCount))
+	return train, test
+}
+
+type groupKey struct {
+	test bool
+	id   interface{}
+}
+
+type groupBatch struct {
+	rows, groups []int
+}
+
+/*
+groupFeed collects the whole dataset and makes batches aligned to groups of rows
+having the same value in the group column. Several groups are packed into one batch
+and the label of every row is (relevance, group) pair where group is the ordinal number of group in batch.
+A group longer than batch size is split into several groups
+*/
+func groupFeed(dataset model.Dataset, features []string, label, test, group string, batchSize int) (fd feed, err error) {
+	t, err := dataset.Source.Lazy().Collect()
+	if err != nil {
+		return
+	}
+	if fu.IndexOf(group, t.Names()) < 0 {
+		err = zorros.Errorf("dataset does not have column `%v`", group)
+		return
+	}
+	if t.Len() == 0 {
+		err = zorros.Errorf("dataset is empty")
+		return
+	}
+	m, err := t.MatrixWithLabel(features, label, t.Len())
+	if err != nil {
+		return
+	}
+	if len(m.Labels) != t.Len() {
+		err = zorros.Errorf("ranking label `%v` must be a scalar", label)
+		return
+	}
+	width := len(m.Features) / t.Len()
+	testCol := t.Col(test).ExtractAs(fu.Bool, true).([]bool)
+	labelCol := t.Col(label)
+	groupCol := t.Col(group)
+
+	index := map[groupKey]int{}
+	var groups [][]int
+	for i := 0; i < t.Len(); i++ {
+		k := groupKey{testCol[i], groupCol.Value(i).Interface()}
+		j, ok := index[k]
+		if !ok {
+			j = len(groups)
+			index[k] = j
+			groups = append(groups, nil)
+		}
+		groups[j] = append(groups[j], i)
+	}
+
+	pack := func(test bool) (r []groupBatch) {
+		gb := groupBatch{}
+		add := func(g []int) {
+			if len(gb.rows)+len(g) > batchSize {
+				r = append(r, gb)
+				gb = groupBatch{}
+			}
+			n := 0
+			if len(gb.groups) > 0 {
+				n = gb.groups[len(gb.groups)-1] + 1
+			}
+			for _, row := range g {
+				gb.rows = append(gb.rows, row)
+				gb.groups = append(gb.groups, n)
+			}
+		}
+		for _, g := range groups {
+			if testCol[g[0]] != test {
+				continue
+			}
+			for len(g) > batchSize {
+				add(g[:batchSize])
+				g = g[batchSize:]
+			}
+			add(g)
+		}
+		if len(gb.rows) > 0 {
+			r = append(r, gb)
+		}
+		return
+	}
+
+	materialize := func(gb groupBatch) *batch {
+		f := make([]float32, batchSize*width)
+		l := make([]float32, batchSize*2)
+		for i, row := range gb.rows {
+			copy(f[i*width:(i+1)*width], m.Features[row*width:(row+1)*width])
+			l[i*2] = m.Labels[row]
+			l[i*2+1] = float32(gb.groups[i])
+		}
+		for i := len(gb.rows); i < batchSize; i++ {
+			l[i*2+1] = -1
+		}
+		rows := gb.rows
+		return &batch{
+			features: f,
+			labels:   l,
+			length:   len(rows),
+			label:    func(i int) reflect.Value { return labelCol.Value(rows[i]) },
+			test:     func(i int) bool { return testCol[rows[i]] },
+			grouped:  true,
+		}
+	}
+
+	drain := func(bs []groupBatch) func(func(*batch) error) error {
+		return func(f func(*batch) error) error {
+			for _, gb := range bs {
+				if err := f(materialize(gb)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	trainBatches := pack(false)
+	fd = feed{
+		train: drain(trainBatches),
+		eval:  drain(append(trainBatches, pack(true)...)),
+		test:  drain(pack(true)),
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package nn
+
+import "go4ml.xyz/nn/mx"
+
+/*
+Penalty is L1/L2 regularization term added to the network loss
+*/
+type Penalty struct {
+	L1, L2 float32
+}
+
+func (p Penalty) of(a *mx.Symbol, reduce func(*mx.Symbol) *mx.Symbol) *mx.Symbol {
+	var r *mx.Symbol
+	if p.L1 != 0 {
+		r = mx.Mul(reduce(mx.Abs(a)), p.L1)
+	}
+	if p.L2 != 0 {
+		q := mx.Mul(reduce(mx.Square(a)), p.L2)
+		if r != nil {
+			q = mx.Add(r, q)
+		}
+		r = q
+	}
+	return r
+}
+
+/*
+Weight returns penalty of layer parameters
+*/
+func (p Penalty) Weight(w *mx.Symbol) *mx.Symbol {
+	return p.of(w, func(a *mx.Symbol) *mx.Symbol { return mx.Sum(a) })
+}
+
+/*
+Activity returns penalty of layer output averaged over batch
+*/
+func (p Penalty) Activity(out *mx.Symbol) *mx.Symbol {
+	return p.of(out, func(a *mx.Symbol) *mx.Symbol { return mx.Mean(mx.SumXl(a, 0)) })
+}
+
+func penalize(out *mx.Symbol, p ...*mx.Symbol) *mx.Symbol {
+	q := make([]*mx.Symbol, 0, len(p))
+	for _, v := range p {
+		if v != nil {
+			q = append(q, v)
+		}
+	}
+	if len(q) == 0 {
+		return out
+	}
+	return mx.Penalty(out, q...)
+}
+
+/*
+NonNeg constraint replaces negative values with zeros
+*/
+type NonNeg struct{}
+
+func (NonNeg) Constrain(a *mx.NDArray) {
+	a.ReLU()
+}
+
+/*
+MaxNorm constraint limits L2 norm of weights incoming to every unit, 2 by default
+*/
+type MaxNorm struct {
+	Value float32
+}
+
+func (c MaxNorm) Constrain(a *mx.NDArray) {
+	var v float32 = 2
+	if c.Value > 0 {
+		v = c.Value
+	}
+	a.Renorm(v, false)
+}
+
+/*
+UnitNorm constraint normalizes weights incoming to every unit to have L2 norm equal to 1
+*/
+type UnitNorm struct{}
+
+func (UnitNorm) Constrain(a *mx.NDArray) {
+	a.Renorm(1, true)
+}
@@ -0,0 +1,68 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+)
+
+/*
+RMSProp optimizer, the centered version of Alex Graves is used when Centered is true
+*/
+type RMSProp struct {
+	Lr, Rho, Mom, Epsilon, Decay float64
+	Centered                     bool
+
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
+}
+
+type stRMSProp struct {
+	N, G, Delta *mx.NDArray
+}
+
+type implRMSProp struct {
+	RMSProp
+	scheduler
+	States map[*mx.NDArray]stRMSProp
+}
+
+func (opt RMSProp) Init(e int) Optimizer {
+	r := &implRMSProp{RMSProp: opt, States: make(map[*mx.NDArray]stRMSProp)}
+	if r.Rho == 0 {
+		r.Rho = 0.9
+	}
+	if r.Mom == 0 {
+		r.Mom = 0.9
+	}
+	if r.Epsilon == 0 {
+		r.Epsilon = 1e-8
+	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.001, opt.Schedule)
+	return r
+}
+
+func (opt *implRMSProp) Release() {
+	for _, v := range opt.States {
+		v.N.Release()
+		if v.G != nil {
+			v.G.Release()
+			v.Delta.Release()
+		}
+	}
+}
+
+func (opt *implRMSProp) Update(params *mx.NDArray, grads *mx.NDArray) {
+	st, ok := opt.States[params]
+	if !ok {
+		st = stRMSProp{N: params.NewLikeThis().Zeros()}
+		if opt.Centered {
+			st.G = params.NewLikeThis().Zeros()
+			st.Delta = params.NewLikeThis().Zeros()
+		}
+		opt.States[params] = st
+	}
+	if opt.Centered {
+		mx.RmspropAlexUpdate(params, grads, st.N, st.G, st.Delta, opt.lr, opt.Rho, opt.Mom, opt.Epsilon, opt.Decay)
+	} else {
+		mx.RmspropUpdate(params, grads, st.N, opt.lr, opt.Rho, opt.Epsilon, opt.Decay)
+	}
+}
@@ -0,0 +1,60 @@
+package nn
+
+import (
+	"go4ml.xyz/nn/mx"
+	"math"
+)
+
+/*
+SAM is Sharpness-Aware Minimization making Optimizer step with gradients calculated
+at params perturbed to the gradient direction by Rho, Rho is 0.05 by default
+*/
+type SAM struct {
+	Optimizer OptimizerConf
+	Rho       float64
+}
+
+type implSAM struct {
+	wrapped
+	SAM
+}
+
+func (opt SAM) Init(e int) Optimizer {
+	r, err := opt.initOptimizer(e)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+func (opt SAM) initOptimizer(e int) (Optimizer, error) {
+	o, err := NewOptimizer(opt.Optimizer, e)
+	if err != nil {
+		return nil, err
+	}
+	r := &implSAM{wrapped: wrapped{o}, SAM: opt}
+	r.Rho = fnzf(r.Rho, 0.05)
+	return r, nil
+}
+
+func (opt *implSAM) Minimize(network *Network, closure func() float32) {
+	sq := 0.
+	for _, g := range network.Graph.Grads {
+		n := float64(g.Norm())
+		sq += n * n
+	}
+	k := float32(opt.Rho / (math.Sqrt(sq) + 1e-12))
+	eps := map[string]*mx.NDArray{}
+	for n, g := range network.Graph.Grads {
+		e := g.Clone().MulScalar(k)
+		network.Graph.Params[n].Add(e)
+		eps[n] = e
+	}
+	closure()
+	for n, e := range eps {
+		network.Graph.Params[n].Sub(e)
+		e.Release()
+	}
+	network.clipGrads()
+	opt.update(network, closure)
+}
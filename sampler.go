@@ -0,0 +1,185 @@
+package nn
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
+/*
+Sampling defines order of training rows in batches
+*/
+type Sampling int
+
+const (
+	Sequential Sampling = iota // rows are trained in dataset order
+	Shuffled                   // rows are shuffled every epoch
+	Stratified                 // rows are shuffled every epoch keeping class proportions of every batch as in dataset
+	Balanced                   // classes are sampled equally, rows of small classes are repeated in epoch
+)
+
+/*
+sampleRow is one training row of batch
+*/
+type sampleRow struct {
+	features, labels []float32
+	label            reflect.Value
+}
+
+/*
+batcher packs rows into batches of the same size
+*/
+type batcher struct {
+	batchSize int
+	rows      []sampleRow
+	f         func(*batch) error
+}
+
+func (bt *batcher) add(r sampleRow) error {
+	if bt.rows = append(bt.rows, r); len(bt.rows) < bt.batchSize {
+		return nil
+	}
+	return bt.flush()
+}
+
+func (bt *batcher) flush() error {
+	if len(bt.rows) == 0 {
+		return nil
+	}
+	rows := bt.rows
+	bt.rows = make([]sampleRow, 0, bt.batchSize)
+	fw, lw := len(rows[0].features), len(rows[0].labels)
+	b := &batch{
+		features: make([]float32, bt.batchSize*fw),
+		labels:   make([]float32, bt.batchSize*lw),
+		length:   len(rows),
+		label:    func(i int) reflect.Value { return rows[i].label },
+		test:     func(int) bool { return false },
+	}
+	for i, r := range rows {
+		copy(b.features[i*fw:(i+1)*fw], r.features)
+		copy(b.labels[i*lw:(i+1)*lw], r.labels)
+	}
+	return bt.f(b)
+}
+
+/*
+drainRows calls f for every row of every training batch
+*/
+func drainRows(fd feed, batchSize int, f func(sampleRow) error) error {
+	return fd.train(func(b *batch) error {
+		fw := len(b.features) / batchSize
+		lw := len(b.labels) / batchSize
+		for i := 0; i < b.length; i++ {
+			r := sampleRow{b.features[i*fw : (i+1)*fw], b.labels[i*lw : (i+1)*lw], b.label(i)}
+			if err := f(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+feed returns feed training rows in order of sampling, rows are ordered again every epoch by seed of the epoch.
+Shuffled sampling with positive buffer shuffles stream of rows by buffer of specified size,
+other samplings collect all training rows
+*/
+func (s Sampling) feed(fd feed, batchSize, buffer int, seed func() int) feed {
+	if s == Sequential {
+		return fd
+	}
+	train := func(f func(*batch) error) error {
+		rng := rand.New(rand.NewSource(int64(seed())))
+		bt := &batcher{batchSize: batchSize, f: f}
+		if s == Shuffled && buffer > 0 {
+			rows := make([]sampleRow, 0, buffer)
+			if err := drainRows(fd, batchSize, func(r sampleRow) error {
+				if len(rows) < buffer {
+					rows = append(rows, r)
+					return nil
+				}
+				i := rng.Intn(buffer)
+				r, rows[i] = rows[i], r
+				return bt.add(r)
+			}); err != nil {
+				return err
+			}
+			rng.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+			for _, r := range rows {
+				if err := bt.add(r); err != nil {
+					return err
+				}
+			}
+			return bt.flush()
+		}
+		var rows []sampleRow
+		if err := drainRows(fd, batchSize, func(r sampleRow) error {
+			rows = append(rows, r)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, i := range s.order(rows, rng) {
+			if err := bt.add(rows[i]); err != nil {
+				return err
+			}
+		}
+		return bt.flush()
+	}
+	return feed{train: train, eval: fd.eval, test: fd.test}
+}
+
+/*
+order returns indices of rows in order of sampling
+*/
+func (s Sampling) order(rows []sampleRow, rng *rand.Rand) []int {
+	if s == Shuffled {
+		return rng.Perm(len(rows))
+	}
+	classes := map[string]int{}
+	var index [][]int
+	for i, r := range rows {
+		k := fmt.Sprint(r.label.Interface())
+		c, ok := classes[k]
+		if !ok {
+			c = len(index)
+			classes[k] = c
+			index = append(index, nil)
+		}
+		index[c] = append(index[c], i)
+	}
+	for _, x := range index {
+		rng.Shuffle(len(x), func(i, j int) { x[i], x[j] = x[j], x[i] })
+	}
+	order := make([]int, 0, len(rows))
+	if s == Stratified {
+		// rows of every class are placed uniformly over the epoch
+		pos := make([]float64, len(rows))
+		for _, x := range index {
+			for j, i := range x {
+				pos[i] = (float64(j) + rng.Float64()) / float64(len(x))
+				order = append(order, i)
+			}
+		}
+		sort.Slice(order, func(i, j int) bool { return pos[order[i]] < pos[order[j]] })
+		return order
+	}
+	// every class has the same count of rows in the epoch
+	next := make([]int, len(index))
+	cls := rng.Perm(len(index))
+	for k := 0; len(order) < len(rows); k++ {
+		if k == len(cls) {
+			k, cls = 0, rng.Perm(len(index))
+		}
+		x := index[cls[k]]
+		if next[cls[k]] == len(x) {
+			next[cls[k]] = 0
+			rng.Shuffle(len(x), func(i, j int) { x[i], x[j] = x[j], x[i] })
+		}
+		order = append(order, x[next[cls[k]]])
+		next[cls[k]]++
+	}
+	return order
+}
@@ -0,0 +1,118 @@
+package nn
+
+import "math"
+
+/*
+LrSchedule calculates learning rate for the optimizer step
+counting from the training start, base is the optimizer learning rate
+*/
+type LrSchedule interface {
+	Lr(step int, base float64) float64
+}
+
+/*
+StepDecay multiplies learning rate by Gamma every Every steps, Gamma is 0.1 by default
+*/
+type StepDecay struct {
+	Every int
+	Gamma float64
+}
+
+func (s StepDecay) Lr(step int, base float64) float64 {
+	if s.Every <= 0 {
+		return base
+	}
+	return base * math.Pow(fnzf(s.Gamma, 0.1), float64(step/s.Every))
+}
+
+/*
+ExpDecay multiplies learning rate by Gamma every step
+*/
+type ExpDecay struct {
+	Gamma float64
+}
+
+func (s ExpDecay) Lr(step int, base float64) float64 {
+	return base * math.Pow(fnzf(s.Gamma, 1), float64(step))
+}
+
+/*
+CosineRestarts anneals learning rate from base to MinLr by cosine during Period steps
+and restarts annealing, every next period is Mult times longer, Mult is 1 by default and can't be less
+*/
+type CosineRestarts struct {
+	Period int
+	Mult   float64
+	MinLr  float64
+}
+
+func (s CosineRestarts) Lr(step int, base float64) float64 {
+	if s.Period <= 0 {
+		return base
+	}
+	mult := math.Max(s.Mult, 1)
+	t, period := float64(step), float64(s.Period)
+	if mult == 1 {
+		t = math.Mod(t, period)
+	}
+	for t >= period {
+		t -= period
+		period *= mult
+	}
+	return s.MinLr + (base-s.MinLr)*(1+math.Cos(math.Pi*t/period))/2
+}
+
+/*
+Warmup linearly increases learning rate from zero to base during Steps steps,
+then Schedule is used if specified with steps counting from the warmup end
+*/
+type Warmup struct {
+	Steps    int
+	Schedule LrSchedule
+}
+
+func (s Warmup) Lr(step int, base float64) float64 {
+	if step < s.Steps {
+		return base * float64(step+1) / float64(s.Steps)
+	}
+	if s.Schedule != nil {
+		return s.Schedule.Lr(step-s.Steps, base)
+	}
+	return base
+}
+
+/*
+OneCycle is the one-cycle policy of Leslie Smith over Steps steps,
+learning rate increases from base/DivFactor to base during PctStart part of steps
+and then is annealed to base/DivFactor/FinalDiv. Both phases use cosine annealing.
+By default PctStart is 0.3, DivFactor is 25 and FinalDiv is 1e4
+*/
+type OneCycle struct {
+	Steps                         int
+	PctStart, DivFactor, FinalDiv float64
+}
+
+func (s OneCycle) Lr(step int, base float64) float64 {
+	if s.Steps <= 0 {
+		return base
+	}
+	anneal := func(from, to, pct float64) float64 {
+		return to + (from-to)*(1+math.Cos(math.Pi*pct))/2
+	}
+	low := base / fnzf(s.DivFactor, 25)
+	final := low / fnzf(s.FinalDiv, 1e4)
+	up := fnzf(s.PctStart, 0.3) * float64(s.Steps)
+	t := math.Min(float64(step), float64(s.Steps))
+	if t < up {
+		return anneal(low, base, t/up)
+	}
+	return anneal(base, final, (t-up)/math.Max(float64(s.Steps)-up, 1))
+}
+
+// fnzf returns the first non-zero value
+func fnzf(v float64, dflt float64) float64 {
+	if v == 0 {
+		return dflt
+	}
+	return v
+}
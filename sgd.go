@@ -5,19 +5,19 @@ import "go4ml.xyz/nn/mx"
 type SGD struct {
 	Lr, Mom, Decay float64
 
-	LrMap map[int]float64
+	LrMap    map[int]float64
+	Schedule LrSchedule // changes learning rate on every optimizer step
 }
 
 func (opt SGD) Init(e int) Optimizer {
 	r := &implSGD{SGD: opt, States: make(map[*mx.NDArray]*mx.NDArray)}
-	if r.Lr == 0 {
-		r.Lr = locateLr(e, opt.LrMap, 0.01)
-	}
+	r.scheduler = newScheduler(e, opt.Lr, opt.LrMap, 0.01, opt.Schedule)
 	return r
 }
 
 type implSGD struct {
 	SGD
+	scheduler
 	States map[*mx.NDArray]*mx.NDArray
 }
 
@@ -34,7 +34,7 @@ func (opt *implSGD) Update(params *mx.NDArray, grads *mx.NDArray) {
 			st = params.NewLikeThis().Zeros()
 			opt.States[params] = st
 		}
-		mx.SgdMomUpdate(params, grads, st, opt.Lr, opt.Mom, 0)
+		mx.SgdMomUpdate(params, grads, st, opt.lr, opt.Mom, 0)
 	}
-	mx.SgdUpdate(params, grads, opt.Lr, opt.Decay)
+	mx.SgdUpdate(params, grads, opt.lr, opt.Decay)
 }
@@ -20,6 +20,16 @@ func resetSymbolId(first int) {
 	_symbolId = first
 }
 
+/*
+frozen returns variable option making it frozen
+*/
+func frozen(on bool) interface{} {
+	if on {
+		return mx.Frozen
+	}
+	return nil
+}
+
 func SaveSymbol(inputdim mx.Dimension, sym *mx.Symbol, output iokit.Output) (err error) {
 	var wr iokit.Whole
 	if wr, err = output.Create(); err != nil {
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"math"
+	"testing"
+)
+
+/*
+lbfgsMinimize fits linear model without bias to labels of weights w by L-BFGS and returns fitted weights
+*/
+func lbfgsMinimize(ly nn.FullyConnected, dtype mx.Dtype, w []float64) []float64 {
+	ly.Name = "dense"
+	ly.Size = 1
+	ly.NoBias = true
+	network := nn.NewWithDtype(mx.CPU, ly, mx.Dim(2), nn.L2Loss{Num: 1}, 4, 42, dtype)
+	defer network.Release()
+	x := []float64{1, 0, 0, 1, 1, 1, 1, 2}
+	y := make([]float64, 4)
+	for i := range y {
+		y[i] = x[i*2]*w[0] + x[i*2+1]*w[1]
+	}
+	network.Input.SetValues(x)
+	network.Label.SetValues(y)
+	opt := nn.LBFGS{MaxIter: 100, Tolerance: 1e-20}.Init(0)
+	defer opt.Release()
+	network.Minimize(opt.(nn.ClosureOptimizer), network.Closure)
+	return network.Params["dense_weight"].Values(mx.Float64).([]float64)
+}
+
+func Test_LBFGSFloat64(t *testing.T) {
+	w := lbfgsMinimize(nn.FullyConnected{}, mx.Float64, []float64{0.3, 0.7})
+	// Float32 values can't be closer to the solution than 1e-8
+	assert.Assert(t, math.Abs(w[0]-0.3) < 1e-9 && math.Abs(w[1]-0.7) < 1e-9, "%v", w)
+}
+
+func Test_LBFGSConstraint(t *testing.T) {
+	w := lbfgsMinimize(nn.FullyConnected{WeightConstraint: nn.NonNeg{}}, mx.Float32, []float64{-0.3, 0.7})
+	assert.Assert(t, w[0] >= 0 && w[1] > 0, "%v", w)
+}
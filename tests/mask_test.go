@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"testing"
+)
+
+// nopOptimizer keeps params unchanged, so gradients of the trained batch can be compared
+type nopOptimizer struct{}
+
+func (nopOptimizer) Release()                         {}
+func (nopOptimizer) Update(params, grads *mx.NDArray) {}
+
+func Test_MaskedPadding(t *testing.T) {
+	for _, loss := range []mx.Loss{nn.L2Loss{Num: 2}, nn.L1Loss{Num: 2}} {
+		ly := nn.FullyConnected{Name: "dense", Size: 2}
+		padded := nn.New(mx.CPU, ly, mx.Dim(3), loss, 4, 42)
+		full := nn.New(mx.CPU, ly, mx.Dim(3), loss, 4, 42)
+		for n, p := range padded.Params {
+			if n[0] != '_' {
+				full.Params[n].SetValues(p.ValuesF32())
+			}
+		}
+
+		data := []float32{1, 2, 3, -1, 0.5, 2}
+		label := []float32{1, 0, 0, 1}
+		// full batch having every row twice has the same gradients as the partial final batch
+		full.Train(append(data, data...), append(label, label...), nopOptimizer{})
+		// the last two rows are padding
+		padded.TrainPartial(append(data, make([]float32, 6)...), append(label, make([]float32, 4)...), 2, nopOptimizer{})
+
+		for n, g := range full.Grads {
+			assertNear(t, padded.Grads[n].ValuesF32(), g.ValuesF32())
+		}
+		assert.Assert(t, len(padded.Grads) == len(full.Grads))
+
+		// the next full batch is not scaled
+		padded.Train(append(data, data...), append(label, label...), nopOptimizer{})
+		for n, g := range full.Grads {
+			assertNear(t, padded.Grads[n].ValuesF32(), g.ValuesF32())
+		}
+
+		padded.Release()
+		full.Release()
+	}
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"go4ml.xyz/base/fu"
 	"go4ml.xyz/base/model"
@@ -9,7 +10,11 @@ import (
 	"go4ml.xyz/nn"
 	"go4ml.xyz/nn/mx"
 	"gotest.tools/assert"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 var mnistMLP0 = nn.Sequence(
@@ -89,3 +94,446 @@ func Test_mnistConv0(t *testing.T) {
 	fmt.Println(lr.Round(5))
 	assert.Assert(t, model.Accuracy(lr) >= 0.98)
 }
+
+func Test_mnistPretrained(t *testing.T) {
+	pretrained := iokit.File(fu.ModelPath("mnist_test_pretrained.zip"))
+	_, err := mnistTrain(mnistModel(nil), pretrained, 2)
+	assert.NilError(t, err)
+
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+		m.Optimizer = nn.Adam{Lr: .0005}
+		m.Pretrained = pretrained
+	}), iokit.File(fu.ModelPath("mnist_test_mlp1.zip")), 1)
+	assert.NilError(t, err)
+	fmt.Println(report.TheBest, report.Score)
+	assert.Assert(t, model.Accuracy(report.Test) >= 0.96)
+}
+
+type freezeCallback struct {
+	nn.NopCallback
+	weights [][]float32
+	grads   []bool
+}
+
+func (c *freezeCallback) OnTrainBegin(tc *nn.TrainContext) {
+	c.weights = append(c.weights, tc.Network.Params["first_weight"].ValuesF32())
+}
+
+func (c *freezeCallback) OnEpochEnd(tc *nn.TrainContext, epoch int, train, test fu.Struct) {
+	_, ok := tc.Network.Grads["first_weight"]
+	c.grads = append(c.grads, ok)
+	c.weights = append(c.weights, tc.Network.Params["first_weight"].ValuesF32())
+}
+
+func Test_mnistUnfreeze(t *testing.T) {
+	cb := &freezeCallback{}
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+		m.Network = nn.Sequence(
+			nn.FullyConnected{Name: "first", Size: 64, Activation: nn.ReLU, Freeze: true},
+			nn.FullyConnected{Size: 10, Activation: nn.Softmax})
+		m.Unfreeze = map[int][]string{2: {"first_*"}}
+		m.Callbacks = []nn.Callback{cb}
+	}), iokit.File(fu.ModelPath("mnist_test_unfreeze.zip")), 3)
+	assert.NilError(t, err)
+	fmt.Println(report.History.Round(5))
+	assert.DeepEqual(t, cb.grads, []bool{false, false, true})
+	assert.DeepEqual(t, cb.weights[1], cb.weights[0])
+	assert.DeepEqual(t, cb.weights[2], cb.weights[0])
+	changed := false
+	for i, v := range cb.weights[3] {
+		changed = changed || v != cb.weights[0][i]
+	}
+	assert.Assert(t, changed)
+}
+
+func Test_mnistOptimizers(t *testing.T) {
+	for _, opt := range []nn.OptimizerConf{
+		nn.RMSProp{},
+		nn.RMSProp{Centered: true},
+		nn.AdaGrad{},
+		nn.AdaDelta{},
+		nn.Nadam{},
+		nn.FTRL{},
+		nn.AdamW{NoDecay: nn.DefaultNoDecay},
+		nn.LAMB{Decay: 0.01, NoDecay: nn.DefaultNoDecay},
+		nn.LARS{Decay: 0.0005, NoDecay: nn.DefaultNoDecay},
+		nn.ParamGroups{
+			Optimizer: nn.Adam{Decay: 0.0001},
+			Groups: []nn.ParamGroup{
+				{Patterns: nn.DefaultNoDecay, NoDecay: true},
+				{Patterns: []string{"FullyConnected01*"}, LrMult: 0.1},
+			}},
+		nn.Lookahead{Optimizer: nn.Adam{}},
+		nn.SAM{Optimizer: nn.SGD{Lr: 0.1, Mom: 0.9}},
+	} {
+		report, err := mnistTrain(mnistModel(func(m *nn.Model) { m.Optimizer = opt }),
+			iokit.File(fu.ModelPath("mnist_test_opt.zip")), 1)
+		assert.NilError(t, err)
+		fmt.Printf("%T %v\n", opt, report.Score)
+		assert.Assert(t, model.Accuracy(report.Test) >= 0.9)
+	}
+}
+
+type accumulateCallback struct {
+	nn.NopCallback
+	batches []int
+	steps   []int
+}
+
+func (c *accumulateCallback) OnEpochBegin(tc *nn.TrainContext, epoch int) {
+	c.batches = append(c.batches, 0)
+}
+
+func (c *accumulateCallback) OnBatchEnd(tc *nn.TrainContext, step int, loss float32) {
+	c.batches[len(c.batches)-1]++
+}
+
+func (c *accumulateCallback) OnEpochEnd(tc *nn.TrainContext, epoch int, train, test fu.Struct) {
+	c.steps = append(c.steps, tc.Network.Steps)
+}
+
+func Test_mnistAccumulate(t *testing.T) {
+	cb := &accumulateCallback{}
+	const accumulate = 1000
+	_, err := mnistTrain(mnistModel(func(m *nn.Model) {
+		m.AccumulateSteps = accumulate
+		m.Callbacks = []nn.Callback{cb}
+	}), iokit.File(fu.ModelPath("mnist_test_accum.zip")), 3)
+	assert.NilError(t, err)
+	fmt.Println(cb.batches, cb.steps)
+	// the last batches of every epoch are not enough for the full accumulation
+	assert.Assert(t, cb.batches[0]%accumulate != 0)
+	perEpoch := (cb.batches[0] + accumulate - 1) / accumulate
+	assert.DeepEqual(t, cb.steps, []int{perEpoch, 2 * perEpoch, 3 * perEpoch})
+}
+
+func Test_mnistAverage(t *testing.T) {
+	for _, avg := range []nn.Averaging{nn.EMA{}, nn.SWA{Start: 1}} {
+		report, err := mnistTrain(mnistModel(func(m *nn.Model) { m.Average = avg }),
+			iokit.File(fu.ModelPath("mnist_test_avg.zip")), 3)
+		assert.NilError(t, err)
+		fmt.Printf("%T %v\n", avg, report.Score)
+		assert.Assert(t, model.Accuracy(report.Test) >= 0.96)
+	}
+}
+
+func Test_mnistPrivacyUnsupported(t *testing.T) {
+	mlp := nn.Sequence(
+		nn.FullyConnected{Size: 64, Activation: nn.ReLU},
+		nn.FullyConnected{Size: 10, Activation: nn.Softmax})
+	dp := &nn.DP{Clip: 1, Noise: 1.1}
+	for _, f := range []func(*nn.Model){
+		func(m *nn.Model) { m.Network, m.Optimizer = mlp, nn.LBFGS{} },
+		func(m *nn.Model) { m.Optimizer = nn.SGD{} },
+		func(m *nn.Model) { m.Network, m.Optimizer, m.AccumulateSteps = mlp, nn.SGD{}, 2 },
+	} {
+		_, err := mnistTrain(mnistModel(func(m *nn.Model) {
+			f(m)
+			m.Privacy = dp
+		}), iokit.File(fu.ModelPath("mnist_test_private.zip")), 1)
+		assert.ErrorContains(t, err, "privacy")
+	}
+}
+
+func Test_mnistFullBatchClip(t *testing.T) {
+	for _, f := range []func(*nn.Model){
+		func(m *nn.Model) { m.ClipValue = 1 },
+		func(m *nn.Model) { m.ClipGlobalNorm = 1 },
+	} {
+		_, err := mnistTrain(mnistModel(func(m *nn.Model) {
+			f(m)
+			m.Optimizer = nn.LBFGS{}
+		}), iokit.File(fu.ModelPath("mnist_test_clip.zip")), 1)
+		assert.ErrorContains(t, err, "clipped")
+	}
+}
+
+func Test_mnistDtype(t *testing.T) {
+	for _, dtype := range []mx.Dtype{mx.Float16, mx.Float64} {
+		modelFile := iokit.File(fu.ModelPath("mnist_test_dtype.zip"))
+		report, err := mnistTrain(mnistModel(func(m *nn.Model) { m.Dtype = dtype }), modelFile, 1)
+		assert.NilError(t, err)
+		fmt.Println(dtype, report.Score)
+		assert.Assert(t, model.Accuracy(report.Test) >= 0.9)
+
+		net1 := nn.LuckyObjectify(modelFile)
+		lr := model.LuckyEvaluate(mnist.T10k, model.LabelCol, net1, 32, model.Classification{})
+		assert.Assert(t, model.Accuracy(lr) >= 0.9)
+	}
+}
+
+type accuracyCallback struct {
+	nn.NopCallback
+	accuracy []float64
+}
+
+func (c *accuracyCallback) OnEpochEnd(tc *nn.TrainContext, epoch int, train, test fu.Struct) {
+	c.accuracy = append(c.accuracy, model.Accuracy(test))
+}
+
+func Test_mnistEarlyStop(t *testing.T) {
+	cb := &accuracyCallback{}
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+		m.Optimizer = nn.Adam{Lr: .01}
+		m.EarlyStop = &nn.EarlyStopping{Metric: "Accuracy", Maximize: true, Patience: 1}
+		m.Callbacks = []nn.Callback{cb}
+	}), iokit.File(fu.ModelPath("mnist_test_stop.zip")), 30)
+	assert.NilError(t, err)
+	fmt.Println(report.TheBest, report.Score, cb.accuracy)
+	fmt.Println(report.History.Round(5))
+	assert.Assert(t, report.History.Len() < 60)
+	// the stopped epoch reports metrics of the best epoch
+	n := len(cb.accuracy)
+	assert.Assert(t, n > 1 && n < 30)
+	best := cb.accuracy[0]
+	for _, a := range cb.accuracy[:n-1] {
+		if a > best {
+			best = a
+		}
+	}
+	assert.Assert(t, cb.accuracy[n-1] == best)
+	assert.Assert(t, model.Accuracy(report.Test) == best)
+	assert.Assert(t, best >= 0.96)
+}
+
+type weightsCallback struct {
+	nn.NopCallback
+	accuracy []float64
+	weights  [][]float32
+	final    []float32
+}
+
+func (c *weightsCallback) OnEpochEnd(tc *nn.TrainContext, epoch int, train, test fu.Struct) {
+	c.accuracy = append(c.accuracy, model.Accuracy(test))
+	c.weights = append(c.weights, tc.Network.Params["first_weight"].ValuesF32())
+}
+
+func (c *weightsCallback) OnTrainEnd(tc *nn.TrainContext) {
+	c.final = tc.Network.Params["first_weight"].ValuesF32()
+}
+
+func Test_mnistEarlyStopAverage(t *testing.T) {
+	cb := &weightsCallback{}
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+		m.Network = nn.Sequence(
+			nn.FullyConnected{Name: "first", Size: 64, Activation: nn.ReLU},
+			nn.FullyConnected{Size: 10, Activation: nn.Softmax})
+		m.Optimizer = nn.Adam{Lr: .01}
+		m.Average = nn.EMA{}
+		m.EarlyStop = &nn.EarlyStopping{Metric: "Accuracy", Maximize: true, Patience: 10}
+		m.Callbacks = []nn.Callback{cb}
+	}), iokit.File(fu.ModelPath("mnist_test_stop_avg.zip")), 4)
+	assert.NilError(t, err)
+	fmt.Println(report.History.Round(5), cb.accuracy)
+	// workout is finished before patience is spent, network has evaluated params of the best epoch
+	n := len(cb.accuracy)
+	assert.Assert(t, n == 4)
+	best := 0
+	for i, a := range cb.accuracy[:n-1] {
+		if a > cb.accuracy[best] {
+			best = i
+		}
+	}
+	assert.Assert(t, cb.accuracy[n-1] == cb.accuracy[best])
+	assert.Assert(t, model.Accuracy(report.Test) == cb.accuracy[best])
+	assert.DeepEqual(t, cb.final, cb.weights[best])
+}
+
+type stopCallback struct {
+	nn.NopCallback
+	batches, epochs int
+	lrSet           bool
+}
+
+func (c *stopCallback) OnBatchEnd(tc *nn.TrainContext, step int, loss float32) {
+	c.batches++
+	if step == 100 {
+		c.lrSet = tc.SetLr(tc.Lr() / 2)
+	}
+}
+
+func (c *stopCallback) OnEpochEnd(tc *nn.TrainContext, epoch int, train, test fu.Struct) {
+	c.epochs++
+	if epoch >= 1 {
+		tc.Stop()
+	}
+}
+
+func Test_mnistCallback(t *testing.T) {
+	cb := &stopCallback{}
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) { m.Callbacks = []nn.Callback{cb} }),
+		iokit.File(fu.ModelPath("mnist_test_cb.zip")), 10)
+	assert.NilError(t, err)
+	fmt.Println(report.Score, cb.batches, cb.epochs)
+	assert.Assert(t, cb.epochs == 2)
+	assert.Assert(t, cb.lrSet)
+	assert.Assert(t, cb.batches > 100)
+	assert.Assert(t, model.Accuracy(report.Test) >= 0.96)
+}
+
+func Test_mnistSampling(t *testing.T) {
+	for _, s := range []struct {
+		sampling nn.Sampling
+		buffer   int
+	}{{nn.Shuffled, 0}, {nn.Shuffled, 1000}, {nn.Stratified, 0}, {nn.Balanced, 0}} {
+		report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+			m.Sampling = s.sampling
+			m.ShuffleBuffer = s.buffer
+		}), iokit.File(fu.ModelPath("mnist_test_sampling.zip")), 2)
+		assert.NilError(t, err)
+		fmt.Println(s.sampling, s.buffer, report.Score)
+		assert.Assert(t, model.Accuracy(report.Test) >= 0.96)
+	}
+}
+
+func Test_mnistCrossValidate(t *testing.T) {
+	cv, err := mnistModel(nil).CrossValidate(mnistDataset(0.8), 3,
+		mnistTraining(iokit.File(fu.ModelPath("mnist_test_cv.zip")), 2))
+	assert.NilError(t, err)
+	fmt.Println(cv.Mean, cv.Std)
+	assert.Assert(t, len(cv.Folds) == 3)
+	assert.Assert(t, len(cv.Validation) == 3)
+	assert.Assert(t, cv.OutOfFold.Len() > 0)
+	mean := 0.
+	for i, r := range cv.Folds {
+		// folds report metrics of test rows, validation metrics are kept separately
+		assert.Assert(t, model.Accuracy(r.Test) >= 0.9)
+		assert.Assert(t, model.Accuracy(cv.Validation[i]) >= 0.9)
+		mean += model.Accuracy(cv.Validation[i]) / 3
+	}
+	assert.Assert(t, math.Abs(model.Accuracy(cv.Mean)-mean) < 1e-9)
+}
+
+type epochsCallback struct {
+	nn.NopCallback
+	epochs []int
+	stopAt int
+}
+
+func (c *epochsCallback) OnBatchEnd(tc *nn.TrainContext, step int, loss float32) {
+	if c.stopAt > 0 && step >= c.stopAt {
+		tc.Stop()
+	}
+}
+
+func (c *epochsCallback) OnEpochEnd(tc *nn.TrainContext, epoch int, train, test fu.Struct) {
+	c.epochs = append(c.epochs, epoch)
+}
+
+func Test_mnistCheapEval(t *testing.T) {
+	for _, x := range []struct {
+		iterations, stopAt int
+		epochs             []int
+	}{
+		{4, 0, []int{1, 3}},
+		{5, 0, []int{1, 3, 4}},
+		{2, 0, []int{1}},
+		{1, 0, []int{0}},
+		{6, 100, []int{0}},
+	} {
+		cb := &epochsCallback{stopAt: x.stopAt}
+		report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+			m.TrainPassMetrics = true
+			m.EvalEvery = 2
+			m.EvalSubsample = 0.5
+			m.Callbacks = []nn.Callback{cb}
+		}), iokit.File(fu.ModelPath("mnist_test_eval.zip")), x.iterations)
+		assert.NilError(t, err)
+		assert.Assert(t, report != nil)
+		fmt.Println(report.History.Round(5))
+		assert.DeepEqual(t, cb.epochs, x.epochs)
+		if x.stopAt == 0 {
+			assert.Assert(t, model.Accuracy(report.Train) >= 0.9)
+			assert.Assert(t, model.Accuracy(report.Test) >= 0.96)
+		}
+	}
+}
+
+func Test_mnistChunkedMapping(t *testing.T) {
+	modelFile := iokit.File(fu.ModelPath("mnist_test_chunked.zip"))
+	_, err := mnistTrain(mnistModel(nil), modelFile, 1)
+	assert.NilError(t, err)
+	net1 := nn.LuckyObjectify(modelFile)
+	t100, err := mnist.T10k.Lazy().First(100).Collect()
+	assert.NilError(t, err)
+	fm, err := net1.FeaturesMapper(32)
+	assert.NilError(t, err)
+	defer fm.Close()
+	r, err := fm.MapFeatures(t100)
+	assert.NilError(t, err)
+	assert.Assert(t, r.Len() == 100)
+	fm1, err := net1.FeaturesMapper(100)
+	assert.NilError(t, err)
+	defer fm1.Close()
+	r1, err := fm1.MapFeatures(t100)
+	assert.NilError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.DeepEqual(t, r.Col(model.PredictedCol).Value(i).Interface(), r1.Col(model.PredictedCol).Value(i).Interface())
+	}
+}
+
+type lrCallback struct {
+	nn.NopCallback
+}
+
+func (c *lrCallback) OnEpochBegin(tc *nn.TrainContext, epoch int) {
+	if epoch == 1 {
+		tc.SetLr(.0005)
+	}
+}
+
+func Test_mnistResume(t *testing.T) {
+	checkpoint := fu.ModelPath("mnist_test_checkpoint_%v.zip")
+	old, _ := filepath.Glob(fmt.Sprintf(checkpoint, "*"))
+	for _, f := range old {
+		_ = os.Remove(f)
+	}
+	train := func(file string, iterations int, resume iokit.Input) *model.Report {
+		report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+			m.Optimizer = nn.Lookahead{Optimizer: nn.Adam{Lr: .001}}
+			m.Callbacks = []nn.Callback{&lrCallback{}}
+			m.Checkpoint = &nn.Checkpoint{File: file, Best: 2}
+			m.Resume = resume
+		}), iokit.File(fu.ModelPath("mnist_test_resume.zip")), iterations)
+		assert.NilError(t, err)
+		return report
+	}
+	full := train(fu.ModelPath("mnist_test_uninterrupted.zip"), 4, nil)
+	_ = train(checkpoint, 2, nil)
+	report := train(checkpoint, 4, iokit.File(fmt.Sprintf(checkpoint, "last")))
+	fmt.Println(report.History.Round(5))
+	assert.Assert(t, report.History.Len() == 8)
+	assert.Assert(t, model.Accuracy(report.Test) >= 0.96)
+
+	// resumed training is the same as uninterrupted one
+	assert.Assert(t, full.History.Len() == report.History.Len())
+	assert.Assert(t, math.Abs(model.Accuracy(full.Test)-model.Accuracy(report.Test)) < 1e-5)
+	assert.Assert(t, math.Abs(model.Accuracy(full.Train)-model.Accuracy(report.Train)) < 1e-5)
+
+	// only the last and the best checkpoints are kept
+	for _, f := range []string{"last", "best1", "best2"} {
+		_, err := os.Stat(fmt.Sprintf(checkpoint, f))
+		assert.NilError(t, err)
+	}
+	files, err := filepath.Glob(fmt.Sprintf(checkpoint, "*"))
+	assert.NilError(t, err)
+	assert.Assert(t, len(files) == 3, "%v", files)
+}
+
+func Test_mnistTimeBudget(t *testing.T) {
+	// budget is spent during the first epoch, so only this epoch is completed
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) { m.TimeBudget = time.Millisecond }),
+		iokit.File(fu.ModelPath("mnist_test_budget.zip")), 100)
+	assert.NilError(t, err)
+	assert.Assert(t, report != nil)
+	fmt.Println(report.History.Round(5))
+	assert.Assert(t, report.History.Len() == 2)
+}
+
+func Test_mnistCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := mnistTrainWithContext(ctx, mnistModel(nil), iokit.File(fu.ModelPath("mnist_test_cancel.zip")), 10)
+	assert.NilError(t, err)
+	assert.Assert(t, report.History.Len() == 2)
+}
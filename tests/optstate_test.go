@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_OptimizerStateRoundTrip(t *testing.T) {
+	for _, dtype := range []mx.Dtype{mx.Float64, mx.Float16} {
+		conf := nn.Lookahead{Optimizer: nn.Adam{Lr: 0.1}, K: 2}
+		newNetwork := func() *nn.Network {
+			ly := nn.FullyConnected{Name: "dense", Size: 2}
+			network := nn.NewWithDtype(mx.CPU, ly, mx.Dim(3), nn.L2Loss{Num: 2}, 2, 42, dtype)
+			network.Input.SetValues([]float32{1, 2, 3, 3, 2, 1})
+			network.Label.SetValues([]float32{1, 0, 0, 1})
+			return network
+		}
+
+		network := newNetwork()
+		opt := conf.Init(0)
+		for i := 0; i < 3; i++ {
+			network.Graph.Forward(true)
+			network.Graph.Backward()
+			network.Update(opt)
+		}
+		file := fu.ModelPath("optstate_test.bin")
+		assert.NilError(t, network.SaveOptimizerState(opt, iokit.File(file)))
+		saved, err := ioutil.ReadFile(file)
+		assert.NilError(t, err)
+
+		// the restored state is written again without any loss
+		network2 := newNetwork()
+		opt2 := conf.Init(0)
+		assert.NilError(t, network2.LoadOptimizerState(opt2, iokit.File(file)))
+		assert.NilError(t, network2.SaveOptimizerState(opt2, iokit.File(file)))
+		resaved, err := ioutil.ReadFile(file)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, resaved, saved)
+
+		opt.Release()
+		opt2.Release()
+		network.Release()
+		network2.Release()
+	}
+}
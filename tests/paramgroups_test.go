@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func Test_ParamGroupsNoDecay(t *testing.T) {
+	opt := nn.ParamGroups{
+		Optimizer: nn.AdamW{Lr: 0.1, Decay: 0.5},
+		Groups:    []nn.ParamGroup{{Patterns: []string{"*_bias"}, NoDecay: true}},
+	}.Init(0)
+	defer opt.Release()
+
+	weight := mx.CPU.Array(mx.Float32, mx.Dim(3), 1, 2, 3)
+	bias := mx.CPU.Array(mx.Float32, mx.Dim(3), 1, 2, 3)
+	grads := mx.CPU.Array(mx.Float32, mx.Dim(3)).Zeros()
+	defer weight.Release()
+	defer bias.Release()
+	defer grads.Release()
+
+	// gradients are zero, so params are changed only by weight decay
+	no := opt.(nn.NamedOptimizer)
+	no.UpdateNamed("dense_weight", weight, grads)
+	no.UpdateNamed("dense_bias", bias, grads)
+	assertNear(t, weight.ValuesF32(), []float32{0.95, 1.9, 2.85})
+	assertNear(t, bias.ValuesF32(), []float32{1, 2, 3})
+}
+
+func Test_ParamGroupsUnsupported(t *testing.T) {
+	_, err := nn.NewOptimizer(nn.ParamGroups{
+		Optimizer: nn.Lookahead{Optimizer: nn.Adam{}},
+		Groups:    []nn.ParamGroup{{Patterns: []string{"*_bias"}, NoDecay: true}},
+	}, 0)
+	assert.ErrorContains(t, err, "does not support weight decay")
+	_, err = nn.NewOptimizer(nn.ParamGroups{
+		Optimizer: nn.SGD{},
+		Groups: []nn.ParamGroup{{
+			Patterns:  []string{"*_bias"},
+			Decay:     0.1,
+			Optimizer: nn.ParamGroups{Optimizer: nn.SGD{}},
+		}},
+	}, 0)
+	assert.ErrorContains(t, err, "does not support weight decay")
+	// wrapped groups report the error too
+	_, err = nn.NewOptimizer(nn.SAM{Optimizer: nn.ParamGroups{
+		Optimizer: nn.SGD{},
+		Groups:    []nn.ParamGroup{{Patterns: []string{"*_bias"}, LrMult: 0.1, Optimizer: nn.Lookahead{Optimizer: nn.SGD{}}}},
+	}}, 0)
+	assert.ErrorContains(t, err, "does not support learning rate multiplier")
+}
@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_ParamsVersion(t *testing.T) {
+	// trained params of Float16 network are written by their Float32 master copies
+	for dtype, magic := range map[mx.Dtype]string{mx.Float32: "ANN1", mx.Float64: "ANN2", mx.Float16: "ANN1"} {
+		ly := nn.FullyConnected{Name: "dense", Size: 2}
+		network := nn.NewWithDtype(mx.CPU, ly, mx.Dim(3), nn.L2Loss{Num: 2}, 2, 42, dtype)
+		file := fu.ModelPath("params_test.bin")
+		assert.NilError(t, network.SaveParams(iokit.File(file)))
+		b, err := ioutil.ReadFile(file)
+		assert.NilError(t, err)
+		assert.Equal(t, string(b[:4]), magic)
+
+		// params are loaded without precision loss
+		loaded := nn.NewWithDtype(mx.CPU, ly, mx.Dim(3), nn.L2Loss{Num: 2}, 2, 0, dtype)
+		assert.NilError(t, loaded.LoadParams(iokit.File(file), true))
+		for n, p := range network.Params {
+			if n[0] != '_' {
+				assert.DeepEqual(t, loaded.Params[n].Values(mx.Float64), p.Values(mx.Float64))
+			}
+		}
+		network.Release()
+		loaded.Release()
+	}
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"fmt"
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/base/model"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func Test_DPEpsilon(t *testing.T) {
+	// MNIST with 60000 rows, batch size 256, noise multiplier 1.1 and 60 epochs spends epsilon about 3
+	eps := nn.DPEpsilon(256./60000, 1.1, 60*60000/256, 1e-5)
+	assert.Assert(t, eps > 2.5 && eps < 3.5)
+	assert.Assert(t, nn.DPEpsilon(256./60000, 1.1, 15*60000/256, 1e-5) < eps)
+	assert.Assert(t, nn.DPEpsilon(256./60000, 2, 60*60000/256, 1e-5) < eps)
+	assert.Assert(t, nn.DPEpsilon(512./60000, 1.1, 60*60000/512, 1e-5) > eps)
+}
+
+func Test_DPFloat64(t *testing.T) {
+	report, err := mnistTrain(mnistModel(func(m *nn.Model) {
+		m.Network = nn.Sequence(
+			nn.FullyConnected{Size: 64, Activation: nn.ReLU},
+			nn.FullyConnected{Size: 10, Activation: nn.Softmax})
+		m.Dtype = mx.Float64
+		m.Privacy = &nn.DP{Clip: 1, Noise: 1.1}
+	}), iokit.File(fu.ModelPath("mnist_test_private64.zip")), 1)
+	assert.NilError(t, err)
+	fmt.Println(report.History.Round(5))
+	assert.Assert(t, model.Accuracy(report.Test) >= 0.8)
+}
@@ -0,0 +1,18 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"gotest.tools/assert"
+	"math"
+	"testing"
+)
+
+func Test_Ndcg(t *testing.T) {
+	assert.Assert(t, nn.Ndcg(10, []float32{3, 2, 1}, []float32{2, 1, 0}) == 1)
+	assert.Assert(t, nn.Ndcg(10, []float32{1, 2, 3}, []float32{0, 0, 0}) == 1)
+	v := nn.Ndcg(10, []float32{1, 2, 3}, []float32{2, 1, 0})
+	x := (1/math.Log2(3) + 3/math.Log2(4)) / (3 + 1/math.Log2(3))
+	assert.Assert(t, math.Abs(v-x) < 1e-9)
+	assert.Assert(t, nn.Ndcg(1, []float32{1, 3, 2}, []float32{0, 1, 0}) == 1)
+	assert.Assert(t, nn.Ndcg(1, []float32{3, 1, 2}, []float32{0, 1, 0}) == 0)
+}
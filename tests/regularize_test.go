@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"gotest.tools/assert"
+	"math"
+	"testing"
+)
+
+const regularizeBatch = 4
+
+var regularizeWeight = []float32{3, -4, 0, 0.1, -0.2, 0.2}
+
+/*
+regularizeNetwork returns network having one dense layer with weights set to regularizeWeight,
+it's fed by zero inputs and labels so the loss gradient of weights is zero
+*/
+func regularizeNetwork(ly nn.FullyConnected) *nn.Network {
+	ly.Name = "dense"
+	ly.Size = 2
+	ly.NoBias = true
+	network := nn.New(mx.CPU, ly, mx.Dim(3), nn.L2Loss{Num: 2}, regularizeBatch, 42)
+	network.Params["dense_weight"].SetValues(regularizeWeight)
+	network.Input.SetValues(make([]float32, regularizeBatch*3))
+	network.Label.SetValues(make([]float32, regularizeBatch*2))
+	return network
+}
+
+func assertNear(t *testing.T, a, b []float32) {
+	assert.Assert(t, len(a) == len(b))
+	for i := range a {
+		assert.Assert(t, math.Abs(float64(a[i]-b[i])) < 1e-5, "%v != %v", a, b)
+	}
+}
+
+func Test_Penalty(t *testing.T) {
+	var l1, l2 float32 = 0.1, 0.01
+	network := regularizeNetwork(nn.FullyConnected{WeightPenalty: nn.Penalty{L1: l1, L2: l2}})
+	defer network.Release()
+	network.Graph.Forward(true)
+	network.Graph.Backward()
+
+	var penalty float32
+	grad := make([]float32, len(regularizeWeight))
+	for i, w := range regularizeWeight {
+		sign := float32(0)
+		if w > 0 {
+			sign = 1
+		} else if w < 0 {
+			sign = -1
+		}
+		penalty += l1*sign*w + l2*w*w
+		grad[i] = l1*sign + 2*l2*w
+	}
+	assertNear(t, network.Outputs[mx.PenaltyName].ValuesF32(), []float32{penalty})
+	assertNear(t, network.Grads["dense_weight"].ValuesF32(), grad)
+
+	// loss of zero outputs is zero, so closure loss is the penalty
+	assertNear(t, []float32{network.Closure()}, []float32{penalty})
+}
+
+func Test_Constraints(t *testing.T) {
+	cases := []struct {
+		constraint mx.Constraint
+		result     []float32
+	}{
+		{nn.NonNeg{}, []float32{3, 0, 0, 0.1, 0, 0.2}},
+		{nn.MaxNorm{Value: 2}, []float32{1.2, -1.6, 0, 0.1, -0.2, 0.2}},
+		{nn.UnitNorm{}, []float32{0.6, -0.8, 0, 1. / 3, -2. / 3, 2. / 3}},
+	}
+	for _, c := range cases {
+		network := regularizeNetwork(nn.FullyConnected{WeightConstraint: c.constraint})
+		opt := nn.SGD{Lr: 0.1}.Init(0)
+		network.Graph.Forward(true)
+		network.Graph.Backward()
+		network.UpdateParams(opt)
+		assertNear(t, network.Params["dense_weight"].ValuesF32(), c.result)
+		opt.Release()
+		network.Release()
+	}
+}
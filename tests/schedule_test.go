@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"gotest.tools/assert"
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func Test_LrSchedule(t *testing.T) {
+	sd := nn.StepDecay{Every: 10}
+	assert.Assert(t, near(sd.Lr(9, 1), 1))
+	assert.Assert(t, near(sd.Lr(10, 1), 0.1))
+	assert.Assert(t, near(sd.Lr(25, 1), 0.01))
+
+	ed := nn.ExpDecay{Gamma: 0.5}
+	assert.Assert(t, near(ed.Lr(0, 1), 1))
+	assert.Assert(t, near(ed.Lr(2, 1), 0.25))
+
+	cr := nn.CosineRestarts{Period: 10, Mult: 2}
+	assert.Assert(t, near(cr.Lr(0, 1), 1))
+	assert.Assert(t, near(cr.Lr(5, 1), 0.5))
+	assert.Assert(t, near(cr.Lr(10, 1), 1))
+	assert.Assert(t, near(cr.Lr(20, 1), 0.5))
+	assert.Assert(t, near(cr.Lr(30, 1), 1))
+
+	for _, mult := range []float64{0, 0.5, -1} {
+		cr := nn.CosineRestarts{Period: 10, Mult: mult}
+		assert.Assert(t, near(cr.Lr(5, 1), 0.5))
+		assert.Assert(t, near(cr.Lr(15, 1), 0.5))
+		assert.Assert(t, near(cr.Lr(1000000, 1), 1))
+	}
+
+	wu := nn.Warmup{Steps: 4, Schedule: ed}
+	assert.Assert(t, near(wu.Lr(0, 1), 0.25))
+	assert.Assert(t, near(wu.Lr(3, 1), 1))
+	assert.Assert(t, near(wu.Lr(5, 1), 0.5))
+
+	oc := nn.OneCycle{Steps: 100, DivFactor: 10, FinalDiv: 10}
+	assert.Assert(t, near(oc.Lr(0, 1), 0.1))
+	assert.Assert(t, near(oc.Lr(30, 1), 1))
+	assert.Assert(t, near(oc.Lr(100, 1), 0.01))
+	assert.Assert(t, oc.Lr(15, 1) > 0.1 && oc.Lr(15, 1) < 1)
+}
+
+func Test_SetLr(t *testing.T) {
+	for _, conf := range []nn.OptimizerConf{
+		nn.SGD{}, nn.Adam{}, nn.Lookahead{Optimizer: nn.Adam{}},
+		nn.ParamGroups{Optimizer: nn.SGD{}, Groups: []nn.ParamGroup{{Patterns: []string{"*_bias"}, Optimizer: nn.Adam{}}}},
+	} {
+		opt := conf.Init(0)
+		tc := &nn.TrainContext{Optimizer: opt}
+		assert.Assert(t, tc.SetLr(0.5))
+		assert.Assert(t, near(tc.Lr(), 0.5))
+		opt.Release()
+	}
+	for _, conf := range []nn.OptimizerConf{nn.LBFGS{}, nn.SAM{Optimizer: nn.LBFGS{}}} {
+		opt := conf.Init(0)
+		tc := &nn.TrainContext{Optimizer: opt}
+		assert.Assert(t, !tc.SetLr(0.5))
+		opt.Release()
+	}
+}
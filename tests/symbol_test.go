@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"go4ml.xyz/base/fu"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/nn/mx/capi"
+	"gotest.tools/assert"
+	"io/ioutil"
+	"testing"
+)
+
+// symbol file written before the optimizer update ops were added,
+// ops are stored by their numeric values
+const oldSymbolFile = `input:
+  shape: [1, 28, 28, 0]
+  len: 3
+symbolic:
+  op: 30
+  args:
+  - op: 43
+    args:
+    - op: 41
+      args:
+      - op: 44
+        args:
+        - op: -2
+      attr: {}
+    attr: {}
+  - op: 53
+    args:
+    - op: 79
+  attr: {}
+`
+
+func Test_SymbolRoundTrip(t *testing.T) {
+	oldFile := fu.ModelPath("old_symbol.yaml")
+	assert.NilError(t, ioutil.WriteFile(oldFile, []byte(oldSymbolFile), 0644))
+
+	sym, dim, err := nn.LoadSymbol(iokit.File(oldFile))
+	assert.NilError(t, err)
+	assert.Assert(t, dim == mx.Dim(1, 28, 28))
+	assert.Assert(t, sym.Op == capi.OpSoftmaxOutput)
+	assert.Assert(t, sym.Args[0].Op == capi.OpFullyConnected)
+	assert.Assert(t, sym.Args[0].Args[0].Op == capi.OpActivation)
+	assert.Assert(t, sym.Args[0].Args[0].Args[0].Op == capi.OpFlatten)
+	assert.Assert(t, sym.Args[1].Op == capi.OpBatchNorm)
+	assert.Assert(t, sym.Args[1].Args[0].Op == capi.OpSwapAxis)
+
+	newFile := iokit.File(fu.ModelPath("new_symbol.yaml"))
+	assert.NilError(t, nn.SaveSymbol(dim, sym, newFile))
+	sym2, dim2, err := nn.LoadSymbol(newFile)
+	assert.NilError(t, err)
+	assert.Assert(t, dim2 == dim)
+	assert.DeepEqual(t, symbolOps(sym2), symbolOps(sym))
+}
+
+func symbolOps(s *mx.Symbol) []capi.MxnetOp {
+	r := []capi.MxnetOp{s.Op}
+	for _, a := range s.Args {
+		r = append(r, symbolOps(a)...)
+	}
+	return r
+}
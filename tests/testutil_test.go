@@ -1,7 +1,13 @@
 package tests
 
 import (
+	"context"
 	"fmt"
+	"go4ml.xyz/base/model"
+	"go4ml.xyz/dataset/mnist"
+	"go4ml.xyz/iokit"
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
 	"gotest.tools/assert/cmp"
 	"strings"
 )
@@ -23,3 +29,56 @@ func PanicWith(text string, f func()) cmp.Comparison {
 	}
 
 }
+
+/*
+mnistModel returns model training mnistMLP0 by Adam with options changed by f
+*/
+func mnistModel(f func(*nn.Model)) nn.Model {
+	m := nn.Model{
+		Network:   mnistMLP0,
+		Optimizer: nn.Adam{Lr: .001},
+		Loss:      nn.CrossEntropyLoss{},
+		Input:     mx.Dim(1, 28, 28),
+		Seed:      42,
+		BatchSize: 32,
+	}
+	if f != nil {
+		f(&m)
+	}
+	return m
+}
+
+/*
+mnistDataset returns mnist training dataset having test rows chosen randomly with probability test
+*/
+func mnistDataset(test float64) model.Dataset {
+	return model.Dataset{
+		Source:   mnist.Data.RandomFlag(model.TestCol, 42, test),
+		Label:    model.LabelCol,
+		Test:     model.TestCol,
+		Features: []string{"Image"},
+	}
+}
+
+/*
+mnistTraining returns training during iterations epochs which are not stopped by the reached accuracy
+*/
+func mnistTraining(modelFile iokit.Output, iterations int) model.Training {
+	return model.Training{
+		Iterations: iterations,
+		ModelFile:  modelFile,
+		Metrics:    model.Classification{Accuracy: 0.999},
+		Score:      model.ErrorScore,
+	}
+}
+
+/*
+mnistTrain trains model on mnist dataset having 20% of test rows
+*/
+func mnistTrain(m nn.Model, modelFile iokit.Output, iterations int) (*model.Report, error) {
+	return mnistTrainWithContext(context.Background(), m, modelFile, iterations)
+}
+
+func mnistTrainWithContext(ctx context.Context, m nn.Model, modelFile iokit.Output, iterations int) (*model.Report, error) {
+	return m.FeedWithContext(ctx, mnistDataset(0.2)).Train(mnistTraining(modelFile, iterations))
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"go4ml.xyz/nn"
+	"go4ml.xyz/nn/mx"
+	"math"
+	"testing"
+)
+
+func Test_WeightNorm(t *testing.T) {
+	ly := nn.WeightNorm(nn.FullyConnected{Name: "dense", Size: 2, NoBias: true})
+	network := nn.New(mx.CPU, ly, mx.Dim(3), nn.L2Loss{Num: 2}, 3, 42)
+	defer network.Release()
+	identity := []float32{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	out := make([]float32, 6)
+
+	v := network.Params["dense_weight"].ValuesF32()
+	norm := make([]float32, 2)
+	for i := range norm {
+		for _, x := range v[i*3 : i*3+3] {
+			norm[i] += x * x
+		}
+		norm[i] = float32(math.Sqrt(float64(norm[i])))
+	}
+	assertNear(t, network.Params["dense_weight_g"].ValuesF32(), norm)
+
+	// initial weight is equal to v
+	network.Forward(identity, out)
+	assertNear(t, out, []float32{v[0], v[3], v[1], v[4], v[2], v[5]})
+
+	// rows of weight have norm g
+	network.Params["dense_weight_g"].SetValues([]float32{1, 2})
+	network.Forward(identity, out)
+	for i := range v {
+		k := float32(1)
+		if i >= 3 {
+			k = 2
+		}
+		v[i] *= k / norm[i/3]
+	}
+	assertNear(t, out, []float32{v[0], v[3], v[1], v[4], v[2], v[5]})
+}
+
+func Test_SpectralNorm(t *testing.T) {
+	ly := nn.SpectralNorm(nn.FullyConnected{Name: "dense", Size: 2, NoBias: true})
+	network := nn.New(mx.CPU, ly, mx.Dim(2), nn.L2Loss{Num: 2}, 2, 42)
+	defer network.Release()
+	identity := []float32{1, 0, 0, 1}
+	out := make([]float32, 4)
+
+	// singular values are 3 and 1
+	network.Params["dense_weight"].SetValues([]float32{2, 1, 1, 2})
+	network.Input.SetValues(identity)
+	for i := 0; i < 20; i++ {
+		network.Graph.Forward(true)
+	}
+
+	// power iteration vector is changed only by training forward
+	u := network.Params["dense_weight_u"].ValuesF32()
+	network.Forward(identity, out)
+	assertNear(t, network.Params["dense_weight_u"].ValuesF32(), u)
+	assertNear(t, u, []float32{math.Sqrt2 / 2, math.Sqrt2 / 2})
+	assertNear(t, out, []float32{2. / 3, 1. / 3, 1. / 3, 2. / 3})
+}
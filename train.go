@@ -1,9 +1,12 @@
 package nn
 
 import (
+	"context"
+	"fmt"
 	"go4ml.xyz/base/fu"
 	"go4ml.xyz/base/model"
 	"go4ml.xyz/base/tables"
+	"go4ml.xyz/nn/mx"
 	"go4ml.xyz/zorros"
 	"reflect"
 )
@@ -14,7 +17,47 @@ func DefaultModelMap(network *Network, features []string, predicts string) model
 	return model.MemorizeMap{"model": mnemosyne{network, features, predicts}}
 }
 
+/*
+withMetric returns copy of metrics with one more value
+*/
+func withMetric(s fu.Struct, name string, value interface{}) fu.Struct {
+	return fu.Struct{
+		Names:   append(append(make([]string, 0, len(s.Names)+1), s.Names...), name),
+		Columns: append(append(make([]reflect.Value, 0, len(s.Columns)+1), s.Columns...), reflect.ValueOf(value)),
+	}
+}
+
 func Train(e Model, dataset model.Dataset, w model.Workout, mmf ModelMapFunction) (report *model.Report, err error) {
+	return TrainWithContext(context.Background(), e, dataset, w, mmf)
+}
+
+/*
+TrainWithContext trains network until context is done or Model.TimeBudget is spent.
+Training and evaluation are interrupted between batches and the report of the last completed epoch is returned,
+so the model memorized by workout is the best one of completed epochs.
+The interrupted epoch is evaluated and completed only if there is no completed epoch
+*/
+func TrainWithContext(ctx context.Context, e Model, dataset model.Dataset, w model.Workout, mmf ModelMapFunction) (report *model.Report, err error) {
+	if e.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.TimeBudget)
+		defer cancel()
+	}
+	report, network, _, err := train(ctx, e, dataset, w, mmf)
+	if network != nil {
+		// network is memorized by workout, so it's not needed anymore
+		network.Release()
+	}
+	return
+}
+
+/*
+train trains network and returns it with the report,
+network has params of the last epoch or params of the best epoch if training uses early stopping.
+When model has Validation column, network has params of the best completed epoch
+and validation metrics of this epoch are returned, test rows are evaluated by these params
+*/
+func train(ctx context.Context, e Model, dataset model.Dataset, w model.Workout, mmf ModelMapFunction) (report *model.Report, network *Network, validation fu.Struct, err error) {
 	t, err := dataset.Source.Lazy().First(1).Collect()
 	if err != nil {
 		return
@@ -34,78 +77,390 @@ func Train(e Model, dataset model.Dataset, w model.Workout, mmf ModelMapFunction
 		return
 	}
 
+	if e.Validation != "" {
+		if fu.IndexOf(e.Validation, t.Names()) < 0 {
+			err = zorros.Errorf("dataset does not have column `%v`", e.Validation)
+			return
+		}
+		if e.Group != "" {
+			err = zorros.Errorf("validation column is not supported for grouped dataset")
+			return
+		}
+	}
+
 	if e.BatchSize <= 0 {
 		e.BatchSize = DefaultBatchSize
 	}
 
 	predicts := fu.Fnzs(e.Predicted, model.PredictedCol)
 
-	network := New(e.Context.Upgrade(), e.Network, e.Input, e.Loss, e.BatchSize, e.Seed)
-	train := dataset.Source.Lazy().IfNotFlag(dataset.Test).Batch(e.BatchSize).Parallel()
-	full := dataset.Source.Lazy().Batch(e.BatchSize).Parallel()
-	out := make([]float32, network.Graph.Output.Dim().Total())
-	loss := make([]float32, network.Graph.Loss.Dim().Total())
+	var fd feed
+	if e.Group != "" {
+		if fd, err = groupFeed(dataset, features, Label, Test, e.Group, e.BatchSize); err != nil {
+			return
+		}
+	} else {
+		fd = streamFeed(dataset, features, Label, Test, e.Validation, e.BatchSize)
+	}
+	epoch := 0 // the current epoch, rows are sampled and dropout is seeded by the epoch seed
+	if e.Sampling != Sequential {
+		if e.Group != "" {
+			err = zorros.Errorf("sampling is not supported for grouped dataset")
+			return
+		}
+		fd = e.Sampling.feed(fd, e.BatchSize, e.ShuffleBuffer, func() int { return e.Seed + epoch })
+	}
 
+	if e.Dtype == mx.Float16 && e.Privacy != nil {
+		err = zorros.Errorf("Float16 network can't be trained with privacy")
+		return
+	}
+	if e.AccumulateSteps > 1 && e.Privacy != nil {
+		err = zorros.Errorf("gradients accumulation is not supported with privacy")
+		return
+	}
+
+	network = NewWithDtype(e.Context.Upgrade(), e.Network, e.Input, e.Loss, e.BatchSize, e.Seed, e.Dtype)
+	defer func(trained *Network) {
+		if err != nil {
+			// network is returned only by successful training
+			trained.Release()
+			network = nil
+		}
+	}(network)
+	if e.Privacy != nil && network.hasBatchNorm() {
+		// BatchNorm mixes rows of batch, so gradients of rows are not independent
+		return nil, nil, fu.Struct{}, zorros.Errorf("network having BatchNorm can't be trained with privacy")
+	}
+	if e.Pretrained != nil {
+		var loaded []string
+		if loaded, err = network.LoadPretrained(e.Pretrained, e.PretrainedNames); err != nil {
+			return nil, nil, fu.Struct{}, zorros.Wrapf(err, "failed to load pretrained model: %s", err.Error())
+		}
+		w.Verbose(fmt.Sprintf("loaded %d pretrained params", len(loaded)))
+	}
+	network.Trainable(e.Trainable...)
+	network.ClipValue = e.ClipValue
+	network.ClipGlobalNorm = e.ClipGlobalNorm
+	network.AccumulateSteps = e.AccumulateSteps
 	network.SummaryOut(true, w.Verbose)
 
-	for done := false; w != nil && !done; w = w.Next() {
-		opt := e.Optimizer.Init(w.Iteration())
+	opt, err := NewOptimizer(e.Optimizer, w.Iteration())
+	if err != nil {
+		return nil, nil, fu.Struct{}, err
+	}
+	network.opt = opt
+	defer func(trained *Network) {
+		trained.opt = nil
+		opt.Release()
+	}(network)
+	if _, ok := opt.(FullBatchOptimizer); ok && e.Dtype == mx.Float16 {
+		return nil, nil, fu.Struct{}, zorros.Errorf("Float16 network can't be trained by full batch optimizer")
+	}
+	if _, ok := opt.(FullBatchOptimizer); ok && e.Privacy != nil {
+		return nil, nil, fu.Struct{}, zorros.Errorf("network can't be trained with privacy by full batch optimizer")
+	}
+	if _, ok := opt.(FullBatchOptimizer); ok && (e.ClipValue > 0 || e.ClipGlobalNorm > 0) {
+		// line search of full batch optimizer needs gradients consistent with loss
+		return nil, nil, fu.Struct{}, zorros.Errorf("gradients of full batch optimizer can't be clipped")
+	}
 
-		if err = train.Drain(func(value reflect.Value) error {
-			if value.Kind() == reflect.Bool {
-				return nil
+	var avg *averager
+	if e.Average != nil {
+		avg = e.Average.newAverager()
+		defer avg.Release()
+	}
+
+	var private *privateTrainer
+	if e.Privacy != nil {
+		private = newPrivateTrainer(*e.Privacy, e)
+		defer private.Release()
+	}
+
+	var stopper *earlyStopper
+	if e.EarlyStop != nil {
+		stopper = e.EarlyStop.newStopper()
+		defer stopper.Release()
+	}
+
+	var best paramsCopy // params of the best completed epoch evaluating test rows when model has Validation column
+	defer best.Release()
+
+	cb := &callbacks{TrainContext{Network: network, Optimizer: opt}, e.Callbacks}
+	ts := trainingState{network, avg, stopper, private, &best, &cb.TrainContext}
+	var ck *checkpointer
+	if e.Checkpoint != nil {
+		ck = e.Checkpoint.newCheckpointer(e.Seed)
+	}
+	done := false
+	if e.Resume != nil {
+		var st checkpointState
+		if st, err = resume(e.Resume, ts); err != nil {
+			return nil, nil, fu.Struct{}, zorros.Wrapf(err, "failed to resume training: %s", err.Error())
+		}
+		if ck != nil {
+			ck.state = st
+		}
+		w.Verbose(fmt.Sprintf("training is resumed from epoch %d", st.Epoch+1))
+		// workout gets metrics history of checkpointed epochs which are already memorized,
+		// the resumed network has params of the last epoch so it's not memorized again
+		memorize := model.MemorizeMap{}
+		for _, h := range st.History {
+			for w != nil && w.Iteration() < h.Epoch {
+				w = w.Next()
 			}
-			t := value.Interface().(*tables.Table)
-			m, err := t.MatrixWithLabel(features, Label, e.BatchSize)
-			if err != nil {
-				return err
+			if w == nil || done {
+				break
+			}
+			if report, done, err = w.Complete(memorize, h.Train.metrics(), h.Test.metrics(), false); err != nil {
+				return nil, nil, fu.Struct{}, zorros.Wrapf(err, "tailed to complete model: %s", err.Error())
 			}
-			network.Train(m.Features, m.Labels, opt)
-			return nil
-		}); err != nil {
-			return
 		}
+		for w != nil && !done && w.Iteration() <= st.Epoch {
+			w = w.Next()
+		}
+	}
+
+	cb.trainBegin()
+	defer func() {
+		if err == nil {
+			cb.trainEnd()
+		}
+	}()
 
-		trainmu := w.TrainMetrics()
-		testmu := w.TestMetrics()
-		if err = full.Drain(func(value reflect.Value) error {
-			if value.Kind() == reflect.Bool {
-				return nil
+	var last model.Workout
+	interrupted := false
+	for ; w != nil && !done; w = w.Next() {
+		if interrupted = ctx.Err() != nil; interrupted && report != nil {
+			break
+		}
+		first := last == nil
+		last = w
+		epoch = w.Iteration()
+		if e.Checkpoint != nil || e.Resume != nil {
+			network.Graph.Ctx.RandomSeed(e.Seed + epoch)
+		}
+		for from, only := range e.Unfreeze {
+			// resumed training unfreezes params of the skipped epochs at the first trained epoch
+			if from == epoch || (first && from < epoch) {
+				network.Unfreeze(only...)
+			}
+		}
+		if so, ok := opt.(ScheduledOptimizer); ok {
+			so.Epoch(w.Iteration())
+		}
+		cb.epochBegin(w.Iteration())
+
+		// the last epoch is always evaluated to not lose trailing epochs
+		evaluated := e.EvalEvery <= 1 || (w.Iteration()+1)%e.EvalEvery == 0 || w.Next() == nil
+		var pass *passMetrics
+		if _, ok := opt.(FullBatchOptimizer); e.TrainPassMetrics && evaluated && !ok && private == nil {
+			pass = newPassMetrics(network, w.TrainMetrics())
+		}
+
+		gradNorm := &gradNormMetric{}
+		if interrupted {
+			// nothing is trained, the interrupted epoch is only evaluated
+		} else if fb, ok := opt.(FullBatchOptimizer); ok {
+			closure, release := network.fullBatchClosure(ctx, fd, &err)
+			var loss float32 // loss of the last closure call is the loss of the current params
+			network.Minimize(fb, func() float32 {
+				loss = closure()
+				return loss
+			})
+			release()
+			interrupted = ctx.Err() != nil
+			cb.lossEnd(loss)
+			gradNorm.update(network.GradNorm)
+			if avg != nil {
+				avg.step(network)
 			}
-			t := value.Interface().(*tables.Table)
-			m, err := t.MatrixWithLabel(features, Label, e.BatchSize)
 			if err != nil {
-				return err
-			}
-			network.Label.SetValues(m.Labels)
-			network.Forward(m.Features, out)
-			resultCol := tables.MatrixColumn(out, e.BatchSize)
-			labelCol := t.Col(Label)
-			network.Loss.CopyValuesTo(loss)
-
-			l := loss[0]
-			for i, c := range t.Col(Test).ExtractAs(fu.Bool, true).([]bool) {
-				if len(loss) > 1 {
-					l = loss[i]
+				return
+			}
+		} else if err = fd.train(func(b *batch) error {
+			if ctx.Err() != nil {
+				interrupted = true
+				return errStopped
+			}
+			steps := network.Steps
+			if private != nil {
+				private.train(network, b, opt)
+				cb.lossEnd(private.loss)
+			} else {
+				network.feedBatch(b, true)
+				network.trainStep(opt)
+				cb.batchEnd(b.length)
+				if pass != nil {
+					pass.update(network, b)
 				}
-				if c {
-					testmu.Update(resultCol.Value(i), labelCol.Value(i), float64(l))
-				} else {
-					trainmu.Update(resultCol.Value(i), labelCol.Value(i), float64(l))
+			}
+			if network.Steps != steps {
+				gradNorm.update(network.GradNorm)
+				if avg != nil {
+					avg.step(network)
 				}
 			}
+			if cb.stopped {
+				return errStopped
+			}
 			return nil
-		}); err != nil {
+		}); err == errStopped {
+			err = nil
+		} else if err != nil {
 			return
 		}
+		if network.flush(opt) {
+			gradNorm.update(network.GradNorm)
+			if avg != nil {
+				avg.step(network)
+			}
+		}
+		if avg != nil {
+			avg.epoch(network, w.Iteration())
+		}
+		rows := 0
+		if private != nil {
+			rows, private.rows = private.rows, 0
+		}
+		if interrupted {
+			w.Verbose(fmt.Sprintf("training is interrupted: %v", ctx.Err()))
+			if report != nil {
+				break
+			}
+		} else if !evaluated && !cb.stopped {
+			continue
+		}
 
-		lr0, _ := trainmu.Complete()
-		lr1, d := testmu.Complete()
-		memorize := mmf(network, features, predicts)
-		if report, done, err = w.Complete(memorize, lr0, lr1, d); err != nil {
-			return nil, zorros.Wrapf(err, "tailed to complete model: %s", err.Error())
+		var trainm, testm fu.Struct
+		if err = avg.use(network, fd, func() (err error) {
+			trainmu := w.TrainMetrics()
+			batches := fd.eval
+			if pass != nil {
+				trainmu, batches = pass.mu, fd.test
+			}
+			if e.EvalSubsample > 0 && e.EvalSubsample < 1 {
+				batches = subsample(batches, e.EvalSubsample, e.Seed)
+			}
+			testmu := w.TestMetrics()
+			var ndcg *ndcgMetric
+			if e.Group != "" {
+				ndcg = &ndcgMetric{k: fu.Ifei(e.NdcgAt > 0, e.NdcgAt, DefaultNdcgAt)}
+			}
+			evalctx := ctx
+			if report == nil {
+				// the first evaluated epoch is completed even if training is interrupted to have the report
+				evalctx = context.Background()
+			}
+			if err = network.evaluate(evalctx, batches, func(b *batch, out, loss []float32) {
+				resultCol := tables.MatrixColumn(out, e.BatchSize)
+				l := loss[0]
+				for i := 0; i < b.length; i++ {
+					if len(loss) > 1 {
+						l = loss[i]
+					}
+					if b.test(i) {
+						if e.Validation == "" {
+							testmu.Update(resultCol.Value(i), b.label(i), float64(l))
+						}
+					} else if b.validation(i) {
+						testmu.Update(resultCol.Value(i), b.label(i), float64(l))
+					} else if pass == nil {
+						trainmu.Update(resultCol.Value(i), b.label(i), float64(l))
+					}
+				}
+				if ndcg != nil {
+					ndcg.update(out, b, e.BatchSize)
+				}
+			}); err != nil {
+				return
+			}
+
+			lr0, _ := trainmu.Complete()
+			lr1, d := testmu.Complete()
+			if ndcg != nil {
+				lr0, lr1 = ndcg.complete(lr0, lr1)
+			}
+			lr0, lr1 = gradNorm.complete(lr0, lr1)
+			if private != nil {
+				eps := private.epsilon(e.BatchSize, rows)
+				lr0 = withMetric(lr0, "Epsilon", eps)
+				lr1 = withMetric(lr1, "Epsilon", eps)
+			}
+			if so, ok := opt.(ScheduledOptimizer); ok {
+				lr0 = withMetric(lr0, "Lr", so.CurrentLr())
+				lr1 = withMetric(lr1, "Lr", so.CurrentLr())
+			}
+			if e.Dtype == mx.Float16 {
+				lr0 = withMetric(lr0, "LossScale", network.LossScale())
+				lr1 = withMetric(lr1, "LossScale", network.LossScale())
+			}
+			if stopper != nil {
+				var stop bool
+				last := w.Next() == nil || cb.stopped || interrupted
+				if lr0, lr1, stop, err = stopper.update(network, lr0, lr1, last); err != nil {
+					return
+				}
+				d = d || stop
+			}
+			trainm, testm = lr0, lr1
+			cb.epochEnd(w.Iteration(), lr0, lr1)
+			d = d || cb.stopped || interrupted
+			memorize := mmf(network, features, predicts)
+			if report, done, err = w.Complete(memorize, lr0, lr1, d); err != nil {
+				return zorros.Wrapf(err, "tailed to complete model: %s", err.Error())
+			}
+			if e.Validation != "" && report != nil && report.TheBest == w.Iteration() {
+				best.save(network)
+			}
+			return
+		}); err != nil {
+			if err == ctx.Err() {
+				// evaluation is interrupted, report has metrics of the previous evaluated epoch
+				w.Verbose(fmt.Sprintf("training is interrupted: %v", err))
+				err = nil
+				break
+			}
+			return nil, nil, fu.Struct{}, err
+		}
+		if ck != nil && !interrupted {
+			if err = ck.update(w.Iteration(), trainm, testm, ts); err != nil {
+				return nil, nil, fu.Struct{}, zorros.Wrapf(err, "failed to write checkpoint: %s", err.Error())
+			}
 		}
 	}
+	// network has params of the best epoch however training is finished
+	stopper.restore(network)
 
+	if e.Validation != "" && report != nil && last != nil {
+		validation = report.Test
+		// test rows are evaluated only once by params of the best epoch which are already averaged
+		evaluate := func() (err error) {
+			testmu := last.TestMetrics()
+			count := 0
+			// test metrics are required by report, so they are calculated even if training is interrupted
+			if err = network.evaluate(context.Background(), fd.eval, func(b *batch, out, loss []float32) {
+				resultCol := tables.MatrixColumn(out, e.BatchSize)
+				for i := 0; i < b.length; i++ {
+					if b.test(i) {
+						testmu.Update(resultCol.Value(i), b.label(i), float64(loss[fu.Ifei(len(loss) > 1, i, 0)]))
+						count++
+					}
+				}
+			}); err != nil {
+				return
+			}
+			if count > 0 {
+				report.Test, _ = testmu.Complete()
+			}
+			return
+		}
+		if best != nil {
+			best.restore(network)
+			err = evaluate()
+		} else {
+			err = avg.use(network, fd, evaluate)
+		}
+	}
 	return
 }
@@ -0,0 +1,126 @@
+package nn
+
+import (
+	"fmt"
+	"go4ml.xyz/nn/mx"
+	"go4ml.xyz/nn/mx/capi"
+	"strconv"
+	"strings"
+)
+
+/*
+weightOf finds the last FullyConnected or Convolution layer of symbol
+and returns the layer symbol and it's weight variable
+*/
+func weightOf(s *mx.Symbol) (layer *mx.Symbol, weight *mx.Symbol) {
+	visited := map[*mx.Symbol]bool{}
+	var find func(*mx.Symbol) bool
+	find = func(s *mx.Symbol) bool {
+		if s == nil || visited[s] {
+			return false
+		}
+		visited[s] = true
+		if (s.Op == capi.OpFullyConnected || s.Op == capi.OpConvolution) && len(s.Args) > 1 {
+			if w := s.Args[1]; w != nil && w.Op == mx.OpVar_ && strings.HasSuffix(w.Name, "_weight") {
+				layer, weight = s, w
+				return true
+			}
+		}
+		for _, a := range s.Args {
+			if find(a) {
+				return true
+			}
+		}
+		return false
+	}
+	if !find(s) {
+		panic("there is no FullyConnected or Convolution layer weight to normalize")
+	}
+	return
+}
+
+/*
+weightShape returns count of layer units and dimensions count of layer weight
+*/
+func weightShape(layer *mx.Symbol) (units int, dims int) {
+	var err error
+	if layer.Op == capi.OpFullyConnected {
+		units, err = strconv.Atoi(layer.Attr[capi.KeyNumHidden])
+		dims = 2
+	} else {
+		units, err = strconv.Atoi(layer.Attr[capi.KeyNumFilter])
+		dims = 3
+		if k := layer.Attr[capi.KeyKernel]; strings.HasPrefix(k, "(") {
+			dims = 2 + len(strings.Split(k, ","))
+		}
+	}
+	if err != nil {
+		panic(fmt.Sprintf("bad count of units in layer %v: %v", layer.Name, err.Error()))
+	}
+	return
+}
+
+func ones(n int) []int {
+	r := make([]int, n)
+	for i := range r {
+		r[i] = 1
+	}
+	return r
+}
+
+type WeightNormBlock struct {
+	block Block
+}
+
+/*
+WeightNorm reparameterizes weight of wrapped FullyConnected or Convolution layer
+as w = g * v/||v|| where norm is calculated over weights incoming to every unit,
+g is initialized by ||v|| so the initial weight is equal to v
+*/
+func WeightNorm(b Block) Block {
+	return &WeightNormBlock{b}
+}
+
+func (wn *WeightNormBlock) Combine(in *mx.Symbol) *mx.Symbol {
+	out := wn.block.Combine(in)
+	layer, v := weightOf(out)
+	units, dims := weightShape(layer)
+	axis := make([]int, dims-1)
+	for i := range axis {
+		axis[i] = i + 1
+	}
+	g := mx.Var(v.Name+"_g", mx.Dim(append([]int{units}, ones(dims-1)...)...), RowNormOf{v.Name})
+	norm := mx.Add(mx.Sqrt(mx.SumKd(mx.Square(v), axis...)), 1e-12)
+	layer.Args[1] = mx.Mul(v, mx.BcastLike(mx.Div(g, norm), v))
+	return out
+}
+
+type SpectralNormBlock struct {
+	block Block
+}
+
+/*
+SpectralNorm reparameterizes weight of wrapped FullyConnected or Convolution layer
+as w = v/sigma(v) where spectral norm sigma is estimated by one step of power iteration per training batch.
+Vector of power iteration is kept between batches in non-gradient variable
+*/
+func SpectralNorm(b Block) Block {
+	return &SpectralNormBlock{b}
+}
+
+func (sn *SpectralNormBlock) Combine(in *mx.Symbol) *mx.Symbol {
+	out := sn.block.Combine(in)
+	layer, v := weightOf(out)
+	units, dims := weightShape(layer)
+	normalize := func(a *mx.Symbol) *mx.Symbol {
+		return mx.BcastDiv(a, mx.Add(mx.Sqrt(mx.Sum(mx.Square(a))), 1e-12))
+	}
+	un := v.Name + "_u"
+	u := mx.Var(un, mx.Nograd, mx.Dim(1, units), Uniform{1})
+	wm := mx.Flatten(v)
+	v1 := mx.BlockGrad(normalize(mx.Dot(u, wm)))
+	u1 := mx.BlockGrad(normalize(mx.Dot(v1, mx.Transpose(wm))))
+	sigma := mx.Reshape(mx.Dot(mx.Dot(u1, wm), mx.Transpose(v1)), ones(dims)...)
+	layer.Args[1] = mx.Mul(v, mx.BcastLike(mx.Div(1, sigma), v))
+	return mx.Assign(out, un, u1)
+}